@@ -0,0 +1,612 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"go.etcd.io/bbolt"
+	"labix.org/v2/mgo/bson"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BoltStore keeps Collections and Strings in a single bbolt file, for teams that don't want to run MongoDB
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+var (
+	boltMeta         = []byte("meta")
+	boltCollections  = []byte("collections")
+	boltStrings      = []byte("strings")
+	boltTexts        = []byte("texts")
+	boltTranslations = []byte("translations")
+	boltVersion      = []byte("version")
+	boltJobs         = []byte("jobs")
+	boltWebhooks     = []byte("webhooks")
+	boltDeliveries   = []byte("deliveries")
+	boltIndex        = []byte("index")
+)
+
+// Migrations are run in order and only once, the schema version is kept in the meta bucket
+var boltMigrations = []func(tx *bbolt.Tx) error{
+
+	// 1: Collections, Strings with a text index, and per-language Translations per String
+	func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{boltCollections, boltStrings, boltTexts, boltTranslations} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+
+	// 2: Jobs
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltJobs)
+		return err
+	},
+
+	// 3: Webhooks and their Deliveries
+	func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{boltWebhooks, boltDeliveries} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+
+	// 4: Index of the words of every String, with a bucket of String ids per word
+	func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltIndex); err != nil {
+			return err
+		}
+		return tx.Bucket(boltStrings).ForEach(func(id, data []byte) error {
+			var s String
+			if err := boltFindString(tx, bson.ObjectId(id), &s); err != nil {
+				return err
+			}
+			return boltReindex(tx, nil, &s)
+		})
+	},
+}
+
+// OpenBoltStore opens (or creates) the file at path and runs all pending migrations
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(boltMeta)
+		if err != nil {
+			return err
+		}
+		version, _ := strconv.Atoi(string(meta.Get(boltVersion)))
+		for i := version; i < len(boltMigrations); i++ {
+			if err := boltMigrations[i](tx); err != nil {
+				return err
+			}
+		}
+		return meta.Put(boltVersion, []byte(strconv.Itoa(len(boltMigrations))))
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// boltGet unmarshals the BSON document stored under key into v
+func boltGet(bucket *bbolt.Bucket, key []byte, v interface{}) error {
+	data := bucket.Get(key)
+	if data == nil {
+		return ErrNotFound
+	}
+	return bson.Unmarshal(data, v)
+}
+
+// boltPut marshals v into BSON and stores it under key
+func boltPut(bucket *bbolt.Bucket, key []byte, v interface{}) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+func (b *BoltStore) FindCollection(id bson.ObjectId, c *Collection) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		*c = Collection{}
+		return boltGet(tx.Bucket(boltCollections), []byte(id), c)
+	})
+}
+
+func (b *BoltStore) FindCollections(name string, after bson.ObjectId, limit int) ([]Collection, error) {
+	var cs []Collection
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltCollections).Cursor()
+		k, data := cursor.First()
+		if after.Valid() {
+			k, data = cursor.Seek([]byte(after))
+			if k != nil && string(k) == string(after) {
+				k, data = cursor.Next()
+			}
+		}
+		for ; k != nil && len(cs) < limit; k, data = cursor.Next() {
+			var c Collection
+			if err := bson.Unmarshal(data, &c); err != nil {
+				return err
+			}
+			if strings.Contains(strings.ToLower(c.Name), strings.ToLower(name)) {
+				cs = append(cs, c)
+			}
+		}
+		return nil
+	})
+	return cs, err
+}
+
+func (b *BoltStore) InsertCollection(c *Collection) error {
+	if !c.Id.Valid() {
+		c.Id = bson.NewObjectId()
+	}
+	c.Modified = time.Now()
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltCollections), []byte(c.Id), c)
+	})
+}
+
+func (b *BoltStore) UpdateCollection(c *Collection) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltCollections)
+		if bucket.Get([]byte(c.Id)) == nil {
+			return ErrNotFound
+		}
+		c.Modified = time.Now()
+		return boltPut(bucket, []byte(c.Id), c)
+	})
+}
+
+func (b *BoltStore) RemoveCollection(id bson.ObjectId) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltCollections)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// boltFindString loads a String and its Translations within tx
+func boltFindString(tx *bbolt.Tx, id bson.ObjectId, s *String) error {
+	*s = String{}
+	if err := boltGet(tx.Bucket(boltStrings), []byte(id), s); err != nil {
+		return err
+	}
+	s.Translations = make(map[string]string)
+	if translations := tx.Bucket(boltTranslations).Bucket([]byte(id)); translations != nil {
+		return translations.ForEach(func(lang, translation []byte) error {
+			s.Translations[string(lang)] = string(translation)
+			return nil
+		})
+	}
+	return nil
+}
+
+// boltPutString stores a String with its Translations in their own bucket within tx, and indexes its words
+func boltPutString(tx *bbolt.Tx, s *String) error {
+	var old *String
+	var found String
+	if err := boltFindString(tx, s.Id, &found); err == nil {
+		old = &found
+	}
+	if err := boltReindex(tx, old, s); err != nil {
+		return err
+	}
+
+	doc := *s
+	doc.Translations = nil
+	if err := boltPut(tx.Bucket(boltStrings), []byte(s.Id), &doc); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltTexts).Put([]byte(textKey(s.String, s.Source, s.Description)), []byte(s.Id)); err != nil {
+		return err
+	}
+	all := tx.Bucket(boltTranslations)
+	if all.Bucket([]byte(s.Id)) != nil {
+		if err := all.DeleteBucket([]byte(s.Id)); err != nil {
+			return err
+		}
+	}
+	translations, err := all.CreateBucket([]byte(s.Id))
+	if err != nil {
+		return err
+	}
+	for lang, translation := range s.Translations {
+		if err := translations.Put([]byte(lang), []byte(translation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltReindex replaces the words of old with the words of s in the index, either can be nil
+func boltReindex(tx *bbolt.Tx, old *String, s *String) error {
+	index := tx.Bucket(boltIndex)
+	if old != nil {
+		for _, token := range stringTokens(old) {
+			ids := index.Bucket([]byte(token))
+			if ids == nil {
+				continue
+			}
+			if err := ids.Delete([]byte(old.Id)); err != nil {
+				return err
+			}
+			if k, _ := ids.Cursor().First(); k == nil {
+				if err := index.DeleteBucket([]byte(token)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if s != nil {
+		for _, token := range stringTokens(s) {
+			ids, err := index.CreateBucketIfNotExists([]byte(token))
+			if err != nil {
+				return err
+			}
+			if err := ids.Put([]byte(s.Id), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *BoltStore) FindString(id bson.ObjectId, s *String) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		return boltFindString(tx, id, s)
+	})
+}
+
+func (b *BoltStore) FindStrings(ids []bson.ObjectId) ([]String, error) {
+	var strs []String
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		for _, id := range ids {
+			var s String
+			err := boltFindString(tx, id, &s)
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			strs = append(strs, s)
+		}
+		return nil
+	})
+	return strs, err
+}
+
+func (b *BoltStore) FindStringByText(str string, source string, description string, s *String) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(boltTexts).Get([]byte(textKey(str, source, description)))
+		if id == nil {
+			return ErrNotFound
+		}
+		return boltFindString(tx, bson.ObjectId(id), s)
+	})
+}
+
+func (b *BoltStore) InsertString(s *String) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+
+		// Strings are unique by text, source language and description
+		if id := tx.Bucket(boltTexts).Get([]byte(textKey(s.String, s.Source, s.Description))); id != nil {
+			return boltFindString(tx, bson.ObjectId(id), s)
+		}
+		if !s.Id.Valid() {
+			s.Id = bson.NewObjectId()
+		}
+		return boltPutString(tx, s)
+	})
+}
+
+func (b *BoltStore) UpdateString(s *String) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		var old String
+		if err := boltGet(tx.Bucket(boltStrings), []byte(s.Id), &old); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltTexts).Delete([]byte(textKey(old.String, old.Source, old.Description))); err != nil {
+			return err
+		}
+		return boltPutString(tx, s)
+	})
+}
+
+func (b *BoltStore) RemoveString(id bson.ObjectId) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		var old String
+		if err := boltFindString(tx, id, &old); err != nil {
+			return err
+		}
+		if err := boltReindex(tx, &old, nil); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltTexts).Delete([]byte(textKey(old.String, old.Source, old.Description))); err != nil {
+			return err
+		}
+		if tx.Bucket(boltTranslations).Bucket([]byte(id)) != nil {
+			if err := tx.Bucket(boltTranslations).DeleteBucket([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltStrings).Delete([]byte(id))
+	})
+}
+
+func (b *BoltStore) SetTranslation(id bson.ObjectId, lang string, translation string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		var old String
+		if err := boltFindString(tx, id, &old); err != nil {
+			return err
+		}
+		translations, err := tx.Bucket(boltTranslations).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+		if err := translations.Put([]byte(lang), []byte(translation)); err != nil {
+			return err
+		}
+		var s String
+		if err := boltFindString(tx, id, &s); err != nil {
+			return err
+		}
+		return boltReindex(tx, &old, &s)
+	})
+}
+
+func (b *BoltStore) RemoveTranslation(id bson.ObjectId, lang string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		var old String
+		if err := boltFindString(tx, id, &old); err != nil {
+			return err
+		}
+		translations := tx.Bucket(boltTranslations).Bucket([]byte(id))
+		if translations == nil {
+			return nil
+		}
+		if err := translations.Delete([]byte(lang)); err != nil {
+			return err
+		}
+		var s String
+		if err := boltFindString(tx, id, &s); err != nil {
+			return err
+		}
+		return boltReindex(tx, &old, &s)
+	})
+}
+
+func (b *BoltStore) SearchStrings(q string, within []bson.ObjectId, after bson.ObjectId, limit int) ([]String, error) {
+	terms := tokenize(q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var strs []String
+	err := b.db.View(func(tx *bbolt.Tx) error {
+
+		// Intersect the Strings of every word, starting with the Collection
+		var found map[string]bool
+		if within != nil {
+			found = make(map[string]bool)
+			for _, id := range within {
+				found[string(id)] = true
+			}
+		}
+		for _, term := range terms {
+			next := make(map[string]bool)
+			if ids := tx.Bucket(boltIndex).Bucket([]byte(term)); ids != nil {
+				err := ids.ForEach(func(id, _ []byte) error {
+					if found == nil || found[string(id)] {
+						next[string(id)] = true
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			found = next
+		}
+
+		ids := make(map[bson.ObjectId]bool)
+		for id := range found {
+			ids[bson.ObjectId(id)] = true
+		}
+		for _, id := range searchPage(ids, after, limit) {
+			var s String
+			if err := boltFindString(tx, id, &s); err != nil {
+				return err
+			}
+			strs = append(strs, s)
+		}
+		return nil
+	})
+	return strs, err
+}
+
+func (b *BoltStore) FindJob(id bson.ObjectId, j *Job) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		*j = Job{}
+		return boltGet(tx.Bucket(boltJobs), []byte(id), j)
+	})
+}
+
+func (b *BoltStore) FindJobs(states []string) ([]Job, error) {
+	var js []Job
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltJobs).ForEach(func(k, data []byte) error {
+			var j Job
+			if err := bson.Unmarshal(data, &j); err != nil {
+				return err
+			}
+			for _, state := range states {
+				if j.State == state {
+					js = append(js, j)
+					break
+				}
+			}
+			return nil
+		})
+	})
+	return js, err
+}
+
+func (b *BoltStore) FindCollectionJobs(id bson.ObjectId) ([]Job, error) {
+	var js []Job
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltJobs).ForEach(func(k, data []byte) error {
+			var j Job
+			if err := bson.Unmarshal(data, &j); err != nil {
+				return err
+			}
+			if j.CollectionId == id {
+				js = append(js, j)
+			}
+			return nil
+		})
+	})
+	return js, err
+}
+
+func (b *BoltStore) InsertJob(j *Job) error {
+	if !j.Id.Valid() {
+		j.Id = bson.NewObjectId()
+	}
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltJobs), []byte(j.Id), j)
+	})
+}
+
+func (b *BoltStore) UpdateJob(j *Job) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltJobs)
+		if bucket.Get([]byte(j.Id)) == nil {
+			return ErrNotFound
+		}
+		return boltPut(bucket, []byte(j.Id), j)
+	})
+}
+
+func (b *BoltStore) FindWebhook(id bson.ObjectId, w *Webhook) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		*w = Webhook{}
+		return boltGet(tx.Bucket(boltWebhooks), []byte(id), w)
+	})
+}
+
+func (b *BoltStore) FindWebhooks(collectionId bson.ObjectId) ([]Webhook, error) {
+	var ws []Webhook
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltWebhooks).ForEach(func(k, data []byte) error {
+			var w Webhook
+			if err := bson.Unmarshal(data, &w); err != nil {
+				return err
+			}
+			if w.CollectionId == collectionId {
+				ws = append(ws, w)
+			}
+			return nil
+		})
+	})
+	return ws, err
+}
+
+func (b *BoltStore) InsertWebhook(w *Webhook) error {
+	if !w.Id.Valid() {
+		w.Id = bson.NewObjectId()
+	}
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltWebhooks), []byte(w.Id), w)
+	})
+}
+
+func (b *BoltStore) RemoveWebhook(id bson.ObjectId) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltWebhooks)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+func (b *BoltStore) FindDelivery(id bson.ObjectId, d *Delivery) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		*d = Delivery{}
+		return boltGet(tx.Bucket(boltDeliveries), []byte(id), d)
+	})
+}
+
+func (b *BoltStore) FindDeliveries(states []string) ([]Delivery, error) {
+	var ds []Delivery
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltDeliveries).ForEach(func(k, data []byte) error {
+			var d Delivery
+			if err := bson.Unmarshal(data, &d); err != nil {
+				return err
+			}
+			for _, state := range states {
+				if d.State == state {
+					ds = append(ds, d)
+					break
+				}
+			}
+			return nil
+		})
+	})
+	return ds, err
+}
+
+func (b *BoltStore) FindWebhookDeliveries(id bson.ObjectId) ([]Delivery, error) {
+	var ds []Delivery
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltDeliveries).ForEach(func(k, data []byte) error {
+			var d Delivery
+			if err := bson.Unmarshal(data, &d); err != nil {
+				return err
+			}
+			if d.WebhookId == id {
+				ds = append(ds, d)
+			}
+			return nil
+		})
+	})
+	return ds, err
+}
+
+func (b *BoltStore) InsertDelivery(d *Delivery) error {
+	if !d.Id.Valid() {
+		d.Id = bson.NewObjectId()
+	}
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return boltPut(tx.Bucket(boltDeliveries), []byte(d.Id), d)
+	})
+}
+
+func (b *BoltStore) UpdateDelivery(d *Delivery) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltDeliveries)
+		if bucket.Get([]byte(d.Id)) == nil {
+			return ErrNotFound
+		}
+		return boltPut(bucket, []byte(d.Id), d)
+	})
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while a provider is skipped after too many failures
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Defaults for every Client, configured in main()
+var (
+	clientTimeout    = 10 * time.Second
+	clientRetries    = 3
+	clientBackoff    = 500 * time.Millisecond
+	clientMaxBackoff = 10 * time.Second
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// HTTPError is returned when a provider responds with an unexpected status code
+type HTTPError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	body := e.Body
+	if len(body) > 200 {
+		body = body[:200] + "..."
+	}
+	return fmt.Sprintf("%s: unexpected status %d: %s", e.Provider, e.StatusCode, body)
+}
+
+// Temporary returns true for status codes that are worth a retry
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == 429 || e.StatusCode >= 500
+}
+
+// Breaker stops calls to a provider for a cooldown period after a number of consecutive failures
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func NewBreaker() *Breaker {
+	return &Breaker{Threshold: breakerThreshold, Cooldown: breakerCooldown}
+}
+
+// Allow returns false while the breaker is open. After the cooldown a single probe is let through,
+// other calls are refused until the probe reports its Success or Failure.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Threshold <= 0 || b.failures < b.Threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.Threshold > 0 && b.failures >= b.Threshold {
+		b.openUntil = time.Now().Add(b.Cooldown)
+	}
+}
+
+// Client makes HTTP requests for a translation provider, with timeouts, retries with
+// exponential backoff on network errors, 429 and 5xx responses, and a circuit breaker
+type Client struct {
+	Name       string
+	HTTP       *http.Client
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Breaker    *Breaker
+}
+
+func NewClient(name string) *Client {
+	return &Client{
+		Name:       name,
+		HTTP:       &http.Client{Timeout: clientTimeout},
+		Retries:    clientRetries,
+		Backoff:    clientBackoff,
+		MaxBackoff: clientMaxBackoff,
+		Breaker:    NewBreaker(),
+	}
+}
+
+// Do sends the request and returns the body of a 2xx response
+func (c *Client) Do(method string, url string, header http.Header, body []byte) ([]byte, error) {
+	var err error
+	backoff := c.Backoff
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if !c.Breaker.Allow() {
+			return nil, fmt.Errorf("%s: %s", c.Name, ErrCircuitOpen)
+		}
+
+		var wait time.Duration
+		var b []byte
+		b, wait, err = c.do(method, url, header, body)
+		if err == nil {
+			c.Breaker.Success()
+			return b, nil
+		}
+
+		// Client errors won't get better by trying again, but the provider is up
+		if e, ok := err.(*HTTPError); ok && !e.Temporary() {
+			c.Breaker.Success()
+			return nil, err
+		}
+		c.Breaker.Failure()
+		if attempt == c.Retries {
+			break
+		}
+
+		// Wait with exponential backoff and jitter, unless the provider asks for longer
+		if wait < backoff {
+			wait = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		}
+		if wait > c.MaxBackoff {
+			wait = c.MaxBackoff
+		}
+		time.Sleep(wait)
+		backoff *= 2
+	}
+	return nil, err
+}
+
+// do makes a single attempt and returns how long the provider asked to wait with Retry-After
+func (c *Client) do(method string, url string, header http.Header, body []byte) ([]byte, time.Duration, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	r, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %s", c.Name, err)
+	}
+	defer r.Body.Close()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %s", c.Name, err)
+	}
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		seconds, _ := strconv.Atoi(r.Header.Get("Retry-After"))
+		return nil, time.Duration(seconds) * time.Second, &HTTPError{
+			Provider:   c.Name,
+			StatusCode: r.StatusCode,
+			Body:       string(b),
+		}
+	}
+	return b, 0, nil
+}
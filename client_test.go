@@ -0,0 +1,110 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/flaky":
+			if calls < 3 {
+				w.WriteHeader(503)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		case "/limited":
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(429)
+		default:
+			w.WriteHeader(400)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient("test")
+	c.Backoff = time.Millisecond
+	c.Breaker.Threshold = 4
+
+	t.Log("Retry on 5xx")
+	body, err := c.Do("GET", ts.URL+"/flaky", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || calls != 3 {
+		t.Errorf("Unexpected body '%s' after %d calls", body, calls)
+	}
+
+	t.Log("Don't retry on 4xx")
+	calls = 0
+	_, err = c.Do("GET", ts.URL+"/bad", nil, nil)
+	if e, ok := err.(*HTTPError); !ok || e.StatusCode != 400 || calls != 1 {
+		t.Errorf("Unexpected error %v after %d calls", err, calls)
+	}
+
+	t.Log("Open the circuit after too many failures")
+	calls = 0
+	_, err = c.Do("GET", ts.URL+"/limited", nil, nil)
+	if e, ok := err.(*HTTPError); !ok || e.StatusCode != 429 || calls != 4 {
+		t.Errorf("Unexpected error %v after %d calls", err, calls)
+	}
+	_, err = c.Do("GET", ts.URL+"/flaky", nil, nil)
+	if err == nil || calls != 4 {
+		t.Errorf("Expected the circuit to be open, got %v after %d calls", err, calls)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := &Breaker{Threshold: 2, Cooldown: 10 * time.Millisecond}
+	b.Failure()
+	b.Failure()
+	if b.Allow() {
+		t.Errorf("Expected the breaker to be open")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	t.Log("Let a single probe through after the cooldown")
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Allow() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 1 {
+		t.Errorf("Expected a single probe, %d calls were allowed", allowed)
+	}
+
+	t.Log("Open again when the probe fails")
+	b.Failure()
+	if b.Allow() {
+		t.Errorf("Expected the breaker to open again")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	t.Log("Close when the probe succeeds")
+	if !b.Allow() {
+		t.Fatalf("Expected a probe after the cooldown")
+	}
+	b.Success()
+	if !b.Allow() || !b.Allow() {
+		t.Errorf("Expected the breaker to be closed")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var deepLUrl = "https://api.deepl.com/v2/translate"
+var deepLFreeUrl = "https://api-free.deepl.com/v2/translate"
+
+// DeepL target languages for the codes in gLangs, Malay and Hindi are not supported
+var deepLLangs = map[string]string{
+	"en":    "EN-US",
+	"zh-CN": "ZH-HANS",
+	"es":    "ES",
+	"ja":    "JA",
+	"de":    "DE",
+	"fr":    "FR",
+	"pt":    "PT-BR",
+	"ru":    "RU",
+	"ar":    "AR",
+	"it":    "IT",
+	"ko":    "KO",
+	"zh-TW": "ZH-HANT",
+	"nl":    "NL",
+	"tr":    "TR",
+	"pl":    "PL",
+	"id":    "ID",
+	"th":    "TH",
+	"sv":    "SV",
+	"no":    "NB",
+	"el":    "EL",
+	"cs":    "CS",
+	"iw":    "HE",
+	"da":    "DA",
+	"ro":    "RO",
+	"vi":    "VI",
+	"fi":    "FI",
+	"uk":    "UK",
+	"hu":    "HU",
+	"sk":    "SK",
+}
+
+// Target languages for which DeepL accepts a formality
+var deepLFormal = map[string]bool{
+	"DE": true, "FR": true, "IT": true, "ES": true, "NL": true, "PL": true,
+	"PT-BR": true, "PT-PT": true, "JA": true, "RU": true,
+}
+
+var deepLFormalities = []string{"default", "more", "less", "prefer_more", "prefer_less"}
+
+// DeepLTranslator translates strings with the DeepL v2 API
+type DeepLTranslator struct {
+	Key       string
+	Formality string
+	Url       string
+	Client    *Client
+}
+
+type DeepLTranslation struct {
+	Translations []struct {
+		DetectedSourceLanguage string `json:"detected_source_language"`
+		Text                   string
+	}
+}
+
+// NewDeepLTranslator validates the formality and picks the API endpoint that belongs to key
+func NewDeepLTranslator(key string, formality string) (*DeepLTranslator, error) {
+	if key == "" {
+		return nil, errors.New("deepl: an API key is required")
+	}
+	if formality == "" {
+		formality = "default"
+	}
+	valid := false
+	for _, f := range deepLFormalities {
+		if f == formality {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("deepl: invalid formality '%s', use one of %s", formality, strings.Join(deepLFormalities, ", "))
+	}
+
+	// Keys of the free plan end with ":fx" and have their own endpoint
+	u := deepLUrl
+	if strings.HasSuffix(key, ":fx") {
+		u = deepLFreeUrl
+	}
+	return &DeepLTranslator{Key: key, Formality: formality, Url: u, Client: NewClient("deepl")}, nil
+}
+
+// deepLSource converts a language code into a DeepL source language, which has no regional variants
+func deepLSource(lang string) string {
+	switch lang {
+	case "iw":
+		return "HE"
+	case "no":
+		return "NB"
+	}
+	return strings.ToUpper(strings.SplitN(lang, "-", 2)[0])
+}
+
+func (d *DeepLTranslator) Name() string {
+	return "deepl"
+}
+
+func (d *DeepLTranslator) Translate(text string, source string, target string) (string, error) {
+	translations, err := d.TranslateBatch([]string{text}, source, target)
+	if err != nil {
+		return "", err
+	}
+	return translations[0], nil
+}
+
+// TranslateBatch sends all texts as "text" values in a single request
+func (d *DeepLTranslator) TranslateBatch(texts []string, source string, target string) ([]string, error) {
+	return d.TranslateContext(texts, "", source, target)
+}
+
+// TranslateContext sends the context along with the texts, DeepL uses it but doesn't translate it
+func (d *DeepLTranslator) TranslateContext(texts []string, context string, source string, target string) ([]string, error) {
+	targetLang, ok := deepLLangs[target]
+	if !ok {
+		return nil, fmt.Errorf("deepl: target language '%s' is not supported", target)
+	}
+
+	// Prepare Values for DeepL API call
+	v := url.Values{}
+	for _, text := range texts {
+		v.Add("text", text)
+	}
+	v.Set("source_lang", deepLSource(source))
+	v.Set("target_lang", targetLang)
+	if d.Formality != "default" && deepLFormal[targetLang] {
+		v.Set("formality", d.Formality)
+	}
+	if context != "" {
+		v.Set("context", context)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "DeepL-Auth-Key "+d.Key)
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Make DeepL API Call and unmarshal json response
+	body, err := d.Client.Do("POST", d.Url, header, []byte(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	var dt DeepLTranslation
+	err = json.Unmarshal(body, &dt)
+	if err != nil {
+		return nil, err
+	}
+	if len(dt.Translations) != len(texts) {
+		return nil, ErrNoTranslation
+	}
+	translations := make([]string, len(texts))
+	for i, t := range dt.Translations {
+		translations[i] = t.Text
+	}
+	return translations, nil
+}
+
+func (d *DeepLTranslator) Languages() []string {
+	langs := make([]string, 0, len(deepLLangs))
+	for lang := range deepLLangs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeepL(t *testing.T) {
+
+	// Stub DeepL API that echoes the request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "DeepL-Auth-Key secret:fx" {
+			w.WriteHeader(403)
+			return
+		}
+		r.ParseForm()
+		text := r.Form.Get("text")
+		if context := r.Form.Get("context"); context != "" {
+			text += " (" + context + ")"
+		}
+		fmt.Fprintf(w, `{"translations":[{"text":"%s>%s %s %s"}]}`,
+			r.Form.Get("source_lang"), r.Form.Get("target_lang"), r.Form.Get("formality"), text)
+	}))
+	defer ts.Close()
+
+	if _, err := NewDeepLTranslator("secret", "very"); err == nil {
+		t.Errorf("Expected an error for an invalid formality")
+	}
+
+	d, err := NewDeepLTranslator("secret:fx", "less")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Url != deepLFreeUrl {
+		t.Errorf("Free key should use %s, got: %s", deepLFreeUrl, d.Url)
+	}
+	d.Url = ts.URL
+
+	tests := []struct{ source, target, expected string }{
+		{"en", "de", "EN>DE less Hello"},
+		{"en", "zh-CN", "EN>ZH-HANS  Hello"},
+		{"zh-TW", "iw", "ZH>HE  Hello"},
+		{"no", "no", "NB>NB  Hello"},
+	}
+	for _, test := range tests {
+		translation, err := d.Translate("Hello", test.source, test.target)
+		if err != nil {
+			t.Error(err)
+		}
+		if translation != test.expected {
+			t.Errorf("Expected '%s', got: '%s'", test.expected, translation)
+		}
+	}
+
+	translations, err := d.TranslateContext([]string{"Open"}, "Button that opens a file", "en", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translations[0] != "EN>DE less Open (Button that opens a file)" {
+		t.Errorf("Context was not sent, got: '%s'", translations[0])
+	}
+
+	if _, err := d.Translate("Hello", "en", "ms"); err == nil {
+		t.Errorf("Expected an error for an unsupported language")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"sync"
+	"time"
+	"translation.io/rest"
+)
+
+// Events about the Strings of a Collection
+const (
+	EventAdded      = "string.added"
+	EventDeleted    = "string.deleted"
+	EventTranslated = "string.translated"
+	EventFailed     = "string.failed"
+	EventEdited     = "string.edited"
+)
+
+// An Event is streamed to the subscribers of a Collection and sent as JSON to its Webhooks
+type Event struct {
+	Type         string
+	CollectionId bson.ObjectId
+	String       String
+	Languages    []string `json:",omitempty"`
+	Created      time.Time
+}
+
+// publish sends e to the subscribers and Webhooks of its Collection without failing the caller,
+// Events are a side effect of changing Strings
+func publish(e Event) {
+	e.Created = time.Now()
+	broker.Publish(e)
+	if hooks == nil {
+		return
+	}
+	err := hooks.Publish(e)
+	if err != nil {
+		fmt.Println("Event " + e.Type + " could not be published: " + err.Error())
+	}
+}
+
+// The Broker that is used by all event streams
+var broker = NewBroker()
+
+// Broker fans out the Events of a Collection to everyone that subscribed to it
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[bson.ObjectId]map[chan Event]bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[bson.ObjectId]map[chan Event]bool)}
+}
+
+// Subscribe returns a channel that receives the Events of a Collection
+func (b *Broker) Subscribe(id bson.ObjectId) chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, 64)
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = make(map[chan Event]bool)
+	}
+	b.subscribers[id][ch] = true
+	return ch
+}
+
+func (b *Broker) Unsubscribe(id bson.ObjectId, ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers[id], ch)
+	if len(b.subscribers[id]) == 0 {
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish sends e to all subscribers of its Collection, subscribers that can't keep up miss Events
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[e.CollectionId] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// heartbeat keeps idle event streams open through proxies
+var heartbeat = 15 * time.Second
+
+// EventStream streams the Events of a Collection as Server-Sent Events until the client disconnects
+func EventStream(w http.ResponseWriter, req *http.Request, id bson.ObjectId) {
+	var c Collection
+	err := store.FindCollection(id, &c)
+	if err != nil {
+		status, response := storeError(err)
+		http.Error(w, response.ToJSON(), status)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, rest.ServerError().ToJSON(), 500)
+		return
+	}
+
+	ch := broker.Subscribe(id)
+	defer broker.Unsubscribe(id, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
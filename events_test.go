@@ -0,0 +1,90 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// readEvent reads lines from an event stream until it has read a whole Event
+func readEvent(t *testing.T, r *bufio.Reader) Event {
+	var e Event
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(line[len("data: "):]), &e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if line == "" && e.Type != "" {
+			return e
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = testTranslator{}
+
+	ts := httptest.NewServer(http.HandlerFunc(APIHandler))
+	defer ts.Close()
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Events")
+	c.Post(v)
+
+	t.Log("GET events of a missing Collection")
+	r, err := http.Get(ts.URL + "/collections/" + bson.NewObjectId().Hex() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != 404 {
+		t.Errorf("Expected status 404, got: %d", r.StatusCode)
+	}
+
+	t.Log("GET events of a Collection")
+	r, err = http.Get(ts.URL + "/collections/" + c.Id.Hex() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected Content-Type: %s", r.Header.Get("Content-Type"))
+	}
+	stream := bufio.NewReader(r.Body)
+	if line, _ := stream.ReadString('\n'); line != ": connected\n" {
+		t.Fatalf("Unexpected first line: %q", line)
+	}
+
+	t.Log("Add, translate and delete a String")
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	v.Set("string", "Live")
+	cs.Post(v)
+	runJobs(t)
+	cs.String.Id = cs.Collection.Strings[0].Id
+	cs.Delete(&url.Values{})
+
+	for _, expected := range []string{EventAdded, EventTranslated, EventDeleted} {
+		e := readEvent(t, stream)
+		if e.Type != expected || e.String.String != "Live" || e.CollectionId != c.Id {
+			t.Errorf("Expected %s, got: %v", expected, e)
+		}
+	}
+}
@@ -2,7 +2,18 @@
 
 package main
 
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+var gTranslateUrl = "https://www.googleapis.com/language/translate/v2"
+
 var gLangs = map[string]string{
+	"en":    "English",
 	"zh-CN": "Chinese Simplified",
 	"es":    "Spanish",
 	"ja":    "Japanese",
@@ -34,3 +45,137 @@ var gLangs = map[string]string{
 	"hu":    "Hungarian",
 	"sk":    "Slovak",
 }
+
+// GoogleTranslator translates strings with the Google Translate v2 API
+type GoogleTranslator struct {
+	Key    string
+	Client *Client
+}
+
+func NewGoogleTranslator(key string) *GoogleTranslator {
+	return &GoogleTranslator{Key: key, Client: NewClient("google")}
+}
+
+type GTranslation struct {
+	Data struct {
+		Translations []struct {
+			TranslatedText string
+		}
+	}
+}
+
+func (g *GoogleTranslator) Name() string {
+	return "google"
+}
+
+func (g *GoogleTranslator) Translate(text string, source string, target string) (string, error) {
+	translations, err := g.TranslateBatch([]string{text}, source, target)
+	if err != nil {
+		return "", err
+	}
+	return translations[0], nil
+}
+
+// TranslateBatch sends all texts as "q" values in a single POST request
+func (g *GoogleTranslator) TranslateBatch(texts []string, source string, target string) ([]string, error) {
+
+	// Prepare Values for GTranslate API call
+	v := &url.Values{}
+	v.Set("key", g.Key)
+	for _, text := range texts {
+		v.Add("q", text)
+	}
+	v.Set("source", source)
+	v.Set("target", target)
+	v.Set("prettyprint", "false")
+
+	// Many "q" values don't fit in a GET url, so POST and let Google treat it as GET
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	header.Set("X-HTTP-Method-Override", "GET")
+
+	// Make GTranslate API Call and unmarshal json response
+	body, err := g.Client.Do("POST", gTranslateUrl, header, []byte(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	var gt GTranslation
+	err = json.Unmarshal(body, &gt)
+	if err != nil {
+		return nil, err
+	}
+	if len(gt.Data.Translations) != len(texts) {
+		return nil, ErrNoTranslation
+	}
+	translations := make([]string, len(texts))
+	for i, t := range gt.Data.Translations {
+		translations[i] = t.TranslatedText
+	}
+	return translations, nil
+}
+
+type GDetection struct {
+	Data struct {
+		Detections [][]struct {
+			Language   string
+			Confidence float64
+		}
+	}
+}
+
+// Google codes that differ from the codes in gLangs
+var gDetected = map[string]string{
+	"he": "iw",
+	"nb": "no",
+	"zh": "zh-CN",
+}
+
+// Detect sends all texts as "q" values to the detect endpoint in a single POST request
+func (g *GoogleTranslator) Detect(texts []string) ([]Detection, error) {
+	v := &url.Values{}
+	v.Set("key", g.Key)
+	for _, text := range texts {
+		v.Add("q", text)
+	}
+	v.Set("prettyprint", "false")
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Make GTranslate API Call and unmarshal json response
+	body, err := g.Client.Do("POST", gTranslateUrl+"/detect", header, []byte(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	var gd GDetection
+	err = json.Unmarshal(body, &gd)
+	if err != nil {
+		return nil, err
+	}
+	if len(gd.Data.Detections) != len(texts) {
+		return nil, errors.New("google: no detection returned")
+	}
+
+	// Every text has a list of detections, the first one is the most likely
+	detections := make([]Detection, len(texts))
+	for i, d := range gd.Data.Detections {
+		if len(d) == 0 {
+			return nil, errors.New("google: no detection returned")
+		}
+		lang := d[0].Language
+		if code, ok := gDetected[lang]; ok {
+			lang = code
+		}
+		detections[i] = Detection{Language: lang, Confidence: d[0].Confidence}
+	}
+	return detections, nil
+}
+
+func (g *GoogleTranslator) Languages() []string {
+	langs := make([]string, 0, len(gLangs))
+	for lang := range gLangs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoogleTranslate(t *testing.T) {
+
+	// Stub Google API that prefixes every text with the target language
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Method != "POST" || r.Header.Get("X-HTTP-Method-Override") != "GET" ||
+			r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			t.Errorf("Unexpected request: %s %v", r.Method, r.Header)
+		}
+		if r.Form.Get("key") != "secret" || r.Form.Get("source") != "en" || r.Form.Get("prettyprint") != "false" {
+			w.WriteHeader(403)
+			return
+		}
+		var translations []string
+		for _, q := range r.Form["q"] {
+			switch q {
+			case "Fail":
+				w.WriteHeader(400)
+				return
+			case "Missing":
+				continue
+			}
+			translations = append(translations, `{"translatedText":"[`+r.Form.Get("target")+`] `+q+`"}`)
+		}
+		fmt.Fprint(w, `{"data":{"translations":[`+strings.Join(translations, ",")+`]}}`)
+	}))
+	defer ts.Close()
+
+	url := gTranslateUrl
+	gTranslateUrl = ts.URL
+	defer func() { gTranslateUrl = url }()
+
+	t.Log("Translations are returned in the order of the texts")
+	g := NewGoogleTranslator("secret")
+	translations, err := g.TranslateBatch([]string{"One", "Two", "Three"}, "en", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(translations, []string{"[de] One", "[de] Two", "[de] Three"}) {
+		t.Errorf("Unexpected translations: %v", translations)
+	}
+
+	t.Log("A response with too few translations is an error")
+	if _, err := g.TranslateBatch([]string{"One", "Missing"}, "en", "de"); err != ErrNoTranslation {
+		t.Errorf("Expected ErrNoTranslation, got: %v", err)
+	}
+
+	t.Log("A failing batch leaves only its own texts untranslated")
+	size := maxBatchSize
+	maxBatchSize = 2
+	defer func() { maxBatchSize = size }()
+	translations, err = translateBatch(g, []string{"One", "Two", "Fail", "Four", "Five"}, nil, "en", "nl")
+	if err == nil {
+		t.Errorf("Expected an error for the failing batch")
+	}
+	if !reflect.DeepEqual(translations, []string{"[nl] One", "[nl] Two", "", "", "[nl] Five"}) {
+		t.Errorf("Unexpected translations: %v", translations)
+	}
+}
+
+func TestGoogleDetect(t *testing.T) {
+
+	// Stub Google API that detects every text as Hebrew, except for English
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/detect" || r.Form.Get("key") != "secret" {
+			w.WriteHeader(403)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"detections":[`)
+		for i, q := range r.Form["q"] {
+			lang := "he"
+			if q == "Hello" {
+				lang = "en"
+			}
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `[{"language":"%s","isReliable":false,"confidence":0.75}]`, lang)
+		}
+		fmt.Fprint(w, `]}}`)
+	}))
+	defer ts.Close()
+
+	url := gTranslateUrl
+	gTranslateUrl = ts.URL
+	defer func() { gTranslateUrl = url }()
+
+	g := NewGoogleTranslator("secret")
+	detections, err := g.Detect([]string{"Hello", "שלום"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Detection{{Language: "en", Confidence: 0.75}, {Language: "iw", Confidence: 0.75}}
+	if len(detections) != 2 || detections[0] != expected[0] || detections[1] != expected[1] {
+		t.Errorf("Unexpected detections: %v", detections)
+	}
+
+	g.Key = "wrong"
+	if _, err := g.Detect([]string{"Hello"}); err == nil {
+		t.Errorf("Expected an error for an invalid key")
+	}
+}
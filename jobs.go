@@ -0,0 +1,571 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"fmt"
+	"labix.org/v2/mgo/bson"
+	"net/url"
+	"sync"
+	"time"
+	"translation.io/rest"
+)
+
+// States of a Job
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// A Job translates Strings into Languages in the background
+type Job struct {
+	Id           bson.ObjectId `bson:"_id"`
+	CollectionId bson.ObjectId `bson:",omitempty"`
+	StringIds    []bson.ObjectId
+	Source       string `bson:",omitempty" json:",omitempty"`
+	Languages    []string
+	Provider     string `bson:",omitempty" json:",omitempty"`
+	State        string
+	Attempts     int
+	Error        string               `bson:",omitempty" json:",omitempty"`
+	Failures     []TranslationFailure `bson:",omitempty" json:",omitempty"`
+	Created      time.Time
+	Started      time.Time `bson:",omitempty" json:",omitempty"`
+	Finished     time.Time `bson:",omitempty" json:",omitempty"`
+
+	// Strings this Job translated per language, and the Strings that failed in its last attempt
+	Translated map[string]int `bson:",omitempty" json:",omitempty"`
+	Failed     map[string]int `bson:",omitempty" json:",omitempty"`
+
+	// Reported by the API only
+	Progress *JobProgress `bson:"-" json:",omitempty"`
+	Duration float64      `bson:"-" json:",omitempty"`
+}
+
+// JobProgress lists the languages of a Job by their state over all Strings of the Job
+type JobProgress struct {
+	Done    []string
+	Failed  []string
+	Pending []string
+}
+
+// jobsById sorts Jobs in the order they were created
+type jobsById []Job
+
+func (js jobsById) Len() int           { return len(js) }
+func (js jobsById) Swap(i, j int)      { js[i], js[j] = js[j], js[i] }
+func (js jobsById) Less(i, j int) bool { return js[i].Id < js[j].Id }
+
+// The JobQueue that is used by all Resources, set in main()
+var jobs *JobQueue
+
+// JobQueue runs Jobs with a pool of workers, Jobs are kept in the Store so they survive restarts
+type JobQueue struct {
+	Workers     int
+	MaxAttempts int
+	Backoff     time.Duration
+	ch          chan bson.ObjectId
+}
+
+func NewJobQueue(workers int) *JobQueue {
+	return &JobQueue{
+		Workers:     workers,
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+	}
+}
+
+// Strings are locked while a worker or a Resource changes them, Collections are locked while a
+// Resource changes them. A Collection is always locked before its Strings.
+var (
+	stringLocks     [64]sync.Mutex
+	collectionLocks [64]sync.Mutex
+)
+
+func lockString(id bson.ObjectId) *sync.Mutex {
+	return &stringLocks[lockIndex(id)%len(stringLocks)]
+}
+
+func lockCollection(id bson.ObjectId) *sync.Mutex {
+	return &collectionLocks[lockIndex(id)%len(collectionLocks)]
+}
+
+// lockIndex hashes an id to pick one of the locks
+func lockIndex(id bson.ObjectId) int {
+	h := 0
+	for i := 0; i < len(id); i++ {
+		h = h*31 + int(id[i])
+	}
+	if h < 0 {
+		h = -h
+	}
+	return h
+}
+
+// Start starts the workers and requeues the Jobs that were unfinished when the server stopped
+func (q *JobQueue) Start() error {
+	q.ch = make(chan bson.ObjectId, 1024)
+	for i := 0; i < q.Workers; i++ {
+		go func() {
+			for id := range q.ch {
+				err := q.Run(id)
+				if err != nil {
+					fmt.Println("Job " + id.Hex() + " could not be run: " + err.Error())
+				}
+			}
+		}()
+	}
+
+	unfinished, err := store.FindJobs([]string{JobQueued, JobRunning})
+	if err != nil {
+		return err
+	}
+	for _, j := range unfinished {
+		q.schedule(j.Id, 0)
+	}
+	return nil
+}
+
+// schedule hands a Job to the workers after a delay, if they are running
+func (q *JobQueue) schedule(id bson.ObjectId, delay time.Duration) {
+	if q.ch == nil {
+		return
+	}
+	time.AfterFunc(delay, func() {
+		q.ch <- id
+	})
+}
+
+// Enqueue stores a new Job and hands it to the workers
+func (q *JobQueue) Enqueue(j *Job) error {
+	j.Id = bson.NewObjectId()
+	j.State = JobQueued
+	j.Created = time.Now()
+	err := store.InsertJob(j)
+	if err != nil {
+		return err
+	}
+	q.schedule(j.Id, 0)
+	return nil
+}
+
+// Run translates the Strings of a Job into the languages that are still pending or failed,
+// a Job with failures is retried with backoff until it runs out of attempts
+func (q *JobQueue) Run(id bson.ObjectId) error {
+	var j Job
+	err := store.FindJob(id, &j)
+	if err != nil {
+		return err
+	}
+	if j.State == JobDone || j.State == JobFailed {
+		return nil
+	}
+
+	j.State = JobRunning
+	j.Attempts++
+	j.Started = time.Now()
+	err = store.UpdateJob(&j)
+	if err != nil {
+		return err
+	}
+
+	// Find the translator of the Job
+	t := translator
+	if j.Provider != "" {
+		var ok bool
+		t, ok = translators[j.Provider]
+		if !ok {
+			return q.finish(&j, nil, "The provider '"+j.Provider+"' is not configured.")
+		}
+	}
+
+	// A provider that could not load its languages when the Job was queued is asked again, the Job is
+	// retried until it can tell them
+	if len(j.Languages) == 0 {
+		j.Languages = targetLangs(t, j.Source)
+		if len(j.Languages) == 0 {
+			return q.finish(&j, nil, "The languages of '"+t.Name()+"' are not available.")
+		}
+	}
+
+	// Strings of a Collection with an automatic source language are translated from their detected language
+	sourceOf := func(s String) string {
+		if j.Source == autoSource {
+			return sourceLang(s.Source)
+		}
+		return sourceLang(j.Source)
+	}
+
+	// Find the languages that every String still needs, Strings that are done are not translated again
+	strs, err := store.FindStrings(j.StringIds)
+	if err != nil {
+		return q.finish(&j, nil, err.Error())
+	}
+	todo := make([]map[string]bool, len(strs))
+	needed := make([][]string, len(strs))
+	var langs []string
+	for _, lang := range j.Languages {
+		any := false
+		for i, s := range strs {
+			if lang == sourceOf(s) {
+				continue
+			}
+			state := s.Status[lang].State
+			if state == "" || state == StatusPending || state == StatusFailed {
+				if todo[i] == nil {
+					todo[i] = make(map[string]bool)
+				}
+				todo[i][lang] = true
+				needed[i] = append(needed[i], lang)
+				any = true
+			}
+		}
+		if any {
+			langs = append(langs, lang)
+		}
+	}
+
+	// Strings are translated in groups with the same source language
+	var sources []string
+	groups := make(map[string][]int)
+	for i, s := range strs {
+		source := sourceOf(s)
+		if _, ok := groups[source]; !ok {
+			sources = append(sources, source)
+		}
+		groups[source] = append(groups[source], i)
+	}
+
+	// Translate all Strings in batches per language, with their descriptions for providers that use them
+	translations := make([]map[string]string, len(strs))
+	var failures []TranslationFailure
+	reasons := make(map[string]string)
+	for _, source := range sources {
+		group := groups[source]
+		texts := make([]string, len(group))
+		contexts := make([]string, len(group))
+		groupTodo := make([]map[string]bool, len(group))
+		for k, i := range group {
+			texts[k] = strs[i].String
+			contexts[k] = strs[i].Description
+			groupTodo[k] = todo[i]
+		}
+		result, failed := translateAll(t, texts, contexts, groupTodo, source, without(langs, source))
+		for k, i := range group {
+			translations[i] = result[k]
+		}
+		for _, failure := range failed {
+			if _, ok := reasons[failure.Language]; !ok {
+				reasons[failure.Language] = failure.Reason
+				failures = append(failures, failure)
+			}
+		}
+	}
+
+	// Save the translations into the latest version of every String, and count them for the Job
+	if j.Translated == nil {
+		j.Translated = make(map[string]int)
+	}
+	j.Failed = make(map[string]int)
+	saved := false
+	for i, s := range strs {
+		if len(needed[i]) == 0 {
+			continue
+		}
+		l := lockString(s.Id)
+		l.Lock()
+		err = store.FindString(s.Id, &s)
+		if err == nil {
+			s.SetTranslations(needed[i], translations[i], reasons)
+			err = store.UpdateString(&s)
+		}
+		l.Unlock()
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return q.finish(&j, failures, err.Error())
+		}
+		saved = true
+		for _, lang := range needed[i] {
+			switch s.Status[lang].State {
+			case StatusMachine:
+				j.Translated[lang]++
+			case StatusFailed:
+				j.Failed[lang]++
+			}
+		}
+		q.publish(&j, &s, needed[i])
+	}
+
+	// New translations modify the Collection of the Job
+	if saved && j.CollectionId.Valid() {
+		err = touchCollection(j.CollectionId)
+		if err != nil && err != ErrNotFound {
+			fmt.Println("Collection " + j.CollectionId.Hex() + " could not be updated: " + err.Error())
+		}
+	}
+
+	return q.finish(&j, failures, "")
+}
+
+// touchCollection updates the Modified time of a Collection
+func touchCollection(id bson.ObjectId) error {
+	l := lockCollection(id)
+	l.Lock()
+	defer l.Unlock()
+	var c Collection
+	err := store.FindCollection(id, &c)
+	if err != nil {
+		return err
+	}
+	return store.UpdateCollection(&c)
+}
+
+// publish notifies the Webhooks of the Collection about the languages of a String that were translated,
+// and about the languages that failed once the Job runs out of attempts
+func (q *JobQueue) publish(j *Job, s *String, langs []string) {
+	if !j.CollectionId.Valid() {
+		return
+	}
+	var translated, failed []string
+	for _, lang := range langs {
+		switch s.Status[lang].State {
+		case StatusMachine:
+			translated = append(translated, lang)
+		case StatusFailed:
+			failed = append(failed, lang)
+		}
+	}
+	if len(translated) > 0 {
+		publish(Event{Type: EventTranslated, CollectionId: j.CollectionId, String: *s, Languages: translated})
+	}
+	if len(failed) > 0 && j.Attempts >= q.MaxAttempts {
+		publish(Event{Type: EventFailed, CollectionId: j.CollectionId, String: *s, Languages: failed})
+	}
+}
+
+// Retry queues a failed Job again with a fresh number of attempts
+func (q *JobQueue) Retry(j *Job) error {
+	j.State = JobQueued
+	j.Attempts = 0
+	j.Error = ""
+	j.Finished = time.Time{}
+	err := store.UpdateJob(j)
+	if err != nil {
+		return err
+	}
+	q.schedule(j.Id, 0)
+	return nil
+}
+
+// finish updates the state of a Job after it ran, and schedules a retry when it has failed
+func (q *JobQueue) finish(j *Job, failures []TranslationFailure, reason string) error {
+	j.Failures = failures
+	j.Error = reason
+	if reason == "" && len(failures) == 0 {
+		j.State = JobDone
+		j.Finished = time.Now()
+		return store.UpdateJob(j)
+	}
+
+	if j.Attempts < q.MaxAttempts {
+		j.State = JobQueued
+		err := store.UpdateJob(j)
+		if err != nil {
+			return err
+		}
+		q.schedule(j.Id, q.Backoff*time.Duration(1<<uint(j.Attempts-1)))
+		return nil
+	}
+
+	j.State = JobFailed
+	j.Finished = time.Now()
+	return store.UpdateJob(j)
+}
+
+// Report fills in the Progress and Duration of a Job
+func (j *Job) Report() {
+
+	// Languages are pending until an attempt of this Job finished, and failed when the last attempt failed for them
+	finished := j.Attempts
+	if j.State == JobRunning {
+		finished--
+	}
+	j.Progress = &JobProgress{Done: []string{}, Failed: []string{}, Pending: []string{}}
+	for _, lang := range j.Languages {
+		if finished < 1 {
+			j.Progress.Pending = append(j.Progress.Pending, lang)
+		} else if j.Error != "" || j.Failed[lang] > 0 {
+			j.Progress.Failed = append(j.Progress.Failed, lang)
+		} else {
+			j.Progress.Done = append(j.Progress.Done, lang)
+		}
+	}
+
+	// Seconds since the Job was created, until it finished
+	end := j.Finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	j.Duration = end.Sub(j.Created).Seconds()
+}
+
+// Implements APIResponse interface
+func (j *Job) ToJSON() string {
+	return rest.ParseAPIResponse(j)
+}
+
+// next returns the methods that can follow on a Job
+func (j *Job) next() *[]rest.Rel {
+	rels := []rest.Rel{
+		rest.Rel{"GET": "/jobs/" + j.Id.Hex()},
+		rest.Rel{"GET": "/collections/" + j.CollectionId.Hex() + "/jobs"},
+		rest.Rel{"GET": "/collections/" + j.CollectionId.Hex()},
+	}
+	if j.State == JobFailed {
+		rels = append(rels, rest.Rel{"POST": "/jobs/" + j.Id.Hex() + "/retry"})
+	}
+	return &rels
+}
+
+func (j *Job) Get(v *url.Values) (int, rest.APIResponse) {
+
+	// GET on /jobs (without an ID) is not allowed
+	if !j.Id.Valid() {
+		return 405, rest.InvalidMethodError(&[]rest.Rel{
+			rest.Rel{"GET": "/jobs/{JobId}"},
+			rest.Rel{"GET": "/collections/{CollectionId}/jobs"},
+		})
+	}
+
+	err := store.FindJob(j.Id, j)
+	if err != nil {
+		return storeError(err)
+	}
+	j.Report()
+	return 200, &rest.APISuccess{
+		"Job":  j,
+		"Next": j.next(),
+	}
+}
+
+func (j *Job) Post(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(&[]rest.Rel{
+		rest.Rel{"GET": "/jobs/" + j.Id.Hex()},
+		rest.Rel{"POST": "/jobs/" + j.Id.Hex() + "/retry"},
+	})
+}
+
+func (j *Job) Put(v *url.Values) (int, rest.APIResponse) {
+	return j.Post(v)
+}
+
+func (j *Job) Delete(v *url.Values) (int, rest.APIResponse) {
+	return j.Post(v)
+}
+
+// JobRetry queues a failed Job again
+type JobRetry struct {
+	Job Job
+}
+
+// Implements APIResponse interface
+func (r *JobRetry) ToJSON() string {
+	return rest.ParseAPIResponse(r)
+}
+
+func (r *JobRetry) Get(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(&[]rest.Rel{
+		rest.Rel{"POST": "/jobs/" + r.Job.Id.Hex() + "/retry"},
+	})
+}
+
+func (r *JobRetry) Post(v *url.Values) (int, rest.APIResponse) {
+	err := store.FindJob(r.Job.Id, &r.Job)
+	if err != nil {
+		return storeError(err)
+	}
+
+	// Only failed Jobs can be retried, others are still being worked on
+	if r.Job.State != JobFailed {
+		return 422, &rest.APIError{
+			Error: rest.ErrorMsg{
+				Type:    "invalid-state",
+				Message: "Only failed jobs can be retried.",
+				Code:    422,
+				Param:   []string{},
+			},
+		}
+	}
+
+	err = jobs.Retry(&r.Job)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+	r.Job.Report()
+	return 200, &rest.APISuccess{
+		"Job":  &r.Job,
+		"Next": r.Job.next(),
+	}
+}
+
+func (r *JobRetry) Put(v *url.Values) (int, rest.APIResponse) {
+	return r.Get(v)
+}
+
+func (r *JobRetry) Delete(v *url.Values) (int, rest.APIResponse) {
+	return r.Get(v)
+}
+
+// CollectionJobs lists the Jobs of a Collection
+type CollectionJobs struct {
+	Collection Collection
+}
+
+// Implements APIResponse interface
+func (c *CollectionJobs) ToJSON() string {
+	return rest.ParseAPIResponse(c)
+}
+
+func (c *CollectionJobs) Get(v *url.Values) (int, rest.APIResponse) {
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+
+	js, err := store.FindCollectionJobs(c.Collection.Id)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+	if js == nil {
+		js = []Job{}
+	}
+	for i := range js {
+		js[i].Report()
+	}
+
+	return 200, &rest.APISuccess{
+		"Jobs": js,
+		"Next": &[]rest.Rel{
+			rest.Rel{"GET": "/jobs/{JobId}"},
+			rest.Rel{"GET": "/collections/" + c.Collection.Id.Hex()},
+		},
+	}
+}
+
+func (c *CollectionJobs) Post(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(&[]rest.Rel{
+		rest.Rel{"GET": "/collections/" + c.Collection.Id.Hex() + "/jobs"},
+	})
+}
+
+func (c *CollectionJobs) Put(v *url.Values) (int, rest.APIResponse) {
+	return c.Post(v)
+}
+
+func (c *CollectionJobs) Delete(v *url.Values) (int, rest.APIResponse) {
+	return c.Post(v)
+}
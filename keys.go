@@ -0,0 +1,184 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"labix.org/v2/mgo/bson"
+	"net/url"
+	"regexp"
+	"translation.io/rest"
+)
+
+// A MessageKey is a stable name for a String within a Collection, so that the text can change
+type MessageKey struct {
+	Key      string
+	StringId bson.ObjectId
+}
+
+// Keys may only contain letters, digits, dots, dashes and underscores, e.g. checkout.button.pay
+var keyRegexp = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,200}$`)
+
+// invalidKey returns the error for a key that can't be used
+func invalidKey(message string) (int, rest.APIResponse) {
+	return 422, &rest.APIError{
+		Error: rest.ErrorMsg{
+			Type:    "invalid-key",
+			Message: message,
+			Code:    422,
+			Param:   []string{"key"},
+		},
+	}
+}
+
+// StringIdOf returns the Id of the String with key
+func (c *Collection) StringIdOf(key string) (bson.ObjectId, bool) {
+	for _, k := range c.Keys {
+		if k.Key == key {
+			return k.StringId, true
+		}
+	}
+	return "", false
+}
+
+// BindKey points key to the String with id, and returns the Id of the String it pointed to before
+func (c *Collection) BindKey(key string, id bson.ObjectId) bson.ObjectId {
+	for i, k := range c.Keys {
+		if k.Key == key {
+			c.Keys[i].StringId = id
+			return k.StringId
+		}
+	}
+	c.Keys = append(c.Keys, MessageKey{Key: key, StringId: id})
+	return ""
+}
+
+// UnbindKey removes key, it returns false when the Collection has no such key
+func (c *Collection) UnbindKey(key string) bool {
+	for i, k := range c.Keys {
+		if k.Key == key {
+			c.Keys = append(c.Keys[:i], c.Keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// KeysOf returns all keys of the String with id
+func (c *Collection) KeysOf(id bson.ObjectId) []string {
+	var keys []string
+	for _, k := range c.Keys {
+		if k.StringId == id {
+			keys = append(keys, k.Key)
+		}
+	}
+	return keys
+}
+
+// RemoveString removes the String with id from the Collection, with its keys, Overrides and Context
+func (c *Collection) RemoveString(id bson.ObjectId) (String, bool) {
+	for i, s := range c.Strings {
+		if s.Id == id {
+			c.Strings = append(c.Strings[:i], c.Strings[i+1:]...)
+			delete(c.Overrides, id.Hex())
+			delete(c.Contexts, id.Hex())
+			for _, key := range c.KeysOf(id) {
+				c.UnbindKey(key)
+			}
+			return s, true
+		}
+	}
+	return String{}, false
+}
+
+// CollectionKeys addresses a String of a Collection by its key
+type CollectionKeys struct {
+	Collection Collection
+	Key        string
+}
+
+// Implements APIResponse interface
+func (c *CollectionKeys) ToJSON() string {
+	return rest.ParseAPIResponse(c)
+}
+
+// path returns the path of the key
+func (c *CollectionKeys) path() string {
+	return "/collections/" + c.Collection.Id.Hex() + "/keys/" + c.Key
+}
+
+func (c *CollectionKeys) Get(v *url.Values) (int, rest.APIResponse) {
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+	id, ok := c.Collection.StringIdOf(c.Key)
+	if !ok {
+		return 404, rest.NotFoundError()
+	}
+
+	var s String
+	err = store.FindString(id, &s)
+	if err != nil {
+		return storeError(err)
+	}
+	c.Collection.Apply(&s)
+	return 200, &rest.APISuccess{
+		"String": s,
+		"Next": &[]rest.Rel{
+			rest.Rel{"PUT": c.path(),
+				"Params": "string, description, screenshot, maxlength",
+			},
+			rest.Rel{"DELETE": c.path()},
+			rest.Rel{"GET": "/collections/" + c.Collection.Id.Hex() + "/strings/" + id.Hex()},
+		},
+	}
+}
+
+func (c *CollectionKeys) Post(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(&[]rest.Rel{
+		rest.Rel{"GET": c.path()},
+		rest.Rel{"PUT": c.path(),
+			"Params": "string, description, screenshot, maxlength",
+		},
+		rest.Rel{"DELETE": c.path()},
+	})
+}
+
+// Put binds the key to a text, which is added to the Collection like any other String
+func (c *CollectionKeys) Put(v *url.Values) (int, rest.APIResponse) {
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Collection.Id
+	values := url.Values{"string": {v.Get("string")}, "key": {c.Key}}
+	for _, param := range []string{"description", "screenshot", "maxlength"} {
+		if _, ok := (*v)[param]; ok {
+			values.Set(param, v.Get(param))
+		}
+	}
+	return cs.Post(&values)
+}
+
+// Delete removes the key, the String stays in the Collection
+func (c *CollectionKeys) Delete(v *url.Values) (int, rest.APIResponse) {
+	l := lockCollection(c.Collection.Id)
+	l.Lock()
+	defer l.Unlock()
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+	if !c.Collection.UnbindKey(c.Key) {
+		return 404, rest.NotFoundError()
+	}
+	err = store.UpdateCollection(&c.Collection)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+	return 200, &rest.APISuccess{
+		"Success": true,
+		"Next": &[]rest.Rel{
+			rest.Rel{"PUT": c.path(),
+				"Params": "string, description, screenshot, maxlength",
+			},
+		},
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestKeys(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = testTranslator{}
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Keys")
+	c.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+
+	t.Log("POST strings with an invalid key")
+	v = &url.Values{}
+	v.Add("string", "Pay now")
+	v.Add("key", "checkout button")
+	if status, _ := cs.Post(v); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("POST strings with keys")
+	v = &url.Values{}
+	v.Add("string", "Pay now")
+	v.Add("key", "checkout.button.pay")
+	v.Add("string", "Cancel")
+	v.Add("key", "checkout.button.cancel")
+	status, res := cs.Post(v)
+	if status != 200 {
+		t.Fatalf("Could not POST strings, status: %d, %s", status, res.ToJSON())
+	}
+	var ps struct {
+		Strings []String
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &ps)
+	if len(ps.Strings) != 2 || len(ps.Strings[0].Keys) != 1 || ps.Strings[0].Keys[0] != "checkout.button.pay" {
+		t.Errorf("Unexpected Strings: %v", ps.Strings)
+	}
+
+	t.Log("GET String by key")
+	ck := Router("/collections/" + c.Id.Hex() + "/keys/checkout.button.pay")
+	status, res = ck.Get(&url.Values{})
+	var p struct {
+		String String
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if status != 200 || p.String.String != "Pay now" {
+		t.Errorf("Unexpected String, status: %d, %v", status, p.String)
+	}
+
+	t.Log("PUT new text for a key")
+	v = &url.Values{}
+	v.Set("string", "Pay")
+	if status, _ := ck.Put(v); status != 200 {
+		t.Fatalf("Could not PUT key, status: %d", status)
+	}
+	c.Get(&url.Values{})
+	if len(c.Strings) != 2 || c.Strings[1].String != "Pay" || c.Strings[1].Keys[0] != "checkout.button.pay" {
+		t.Errorf("Key was not rebound: %v", c.Strings)
+	}
+
+	t.Log("POST strings that swap their keys")
+	v = &url.Values{}
+	v.Add("string", "Pay")
+	v.Add("key", "checkout.button.cancel")
+	v.Add("string", "Cancel")
+	v.Add("key", "checkout.button.pay")
+	if status, _ := cs.Post(v); status != 200 {
+		t.Fatalf("Could not POST strings, status: %d", status)
+	}
+	c.Get(&url.Values{})
+	if len(c.Strings) != 2 {
+		t.Fatalf("A String with a swapped key was removed: %v", c.Strings)
+	}
+	for _, s := range c.Strings {
+		if len(s.Keys) != 1 || s.String == "Pay" && s.Keys[0] != "checkout.button.cancel" || s.String == "Cancel" && s.Keys[0] != "checkout.button.pay" {
+			t.Errorf("Keys were not swapped: %v", s)
+		}
+	}
+
+	t.Log("DELETE key")
+	if status, _ := ck.Delete(&url.Values{}); status != 200 {
+		t.Fatalf("Could not DELETE key, status: %d", status)
+	}
+	if status, _ := ck.Get(&url.Values{}); status != 404 {
+		t.Errorf("Expected status 404, got: %d", status)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LibreTranslate codes for the codes in gLangs that differ, in order of preference
+var libreLangs = map[string][]string{
+	"zh-CN": []string{"zh-Hans", "zh"},
+	"zh-TW": []string{"zh-Hant", "zt"},
+	"iw":    []string{"he"},
+	"no":    []string{"nb", "no"},
+}
+
+// The languages of a LibreTranslate server that could not be reached are loaded again after libreRetry
+var libreRetry = 30 * time.Second
+
+// LibreTranslator translates strings with a self-hosted LibreTranslate compatible API
+type LibreTranslator struct {
+	Url    string
+	Key    string
+	Client *Client
+	mu     sync.Mutex
+	codes  map[string]string
+	err    error
+	tried  time.Time
+}
+
+type LibreLanguage struct {
+	Code string
+	Name string
+}
+
+type LibreTranslation struct {
+	TranslatedText string `json:"translatedText"`
+}
+
+type LibreBatchTranslation struct {
+	TranslatedText []string `json:"translatedText"`
+}
+
+// NewLibreTranslator returns a translator for the API at u, the languages it supports are loaded
+// on first use so that the server may be down while translation.io starts
+func NewLibreTranslator(u string, key string) (*LibreTranslator, error) {
+	if u == "" {
+		return nil, errors.New("libretranslate: a URL is required")
+	}
+	return &LibreTranslator{Url: strings.TrimRight(u, "/"), Key: key, Client: NewClient("libretranslate")}, nil
+}
+
+// languages returns our language codes mapped to the codes of the server. Until they are loaded the
+// provider is unavailable, and loading is tried again at most once every libreRetry.
+func (l *LibreTranslator) languages() (map[string]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.codes != nil {
+		return l.codes, nil
+	}
+	if l.err != nil && time.Since(l.tried) < libreRetry {
+		return nil, l.err
+	}
+	l.tried = time.Now()
+	l.err = nil
+
+	body, err := l.Client.Do("GET", l.Url+"/languages", nil, nil)
+	if err == nil {
+		var languages []LibreLanguage
+		err = json.Unmarshal(body, &languages)
+		if err == nil {
+			l.codes = libreCodes(languages)
+			return l.codes, nil
+		}
+	}
+	l.err = fmt.Errorf("libretranslate: languages could not be loaded: %s", err)
+	return nil, l.err
+}
+
+// libreCodes maps our language codes to the codes of languages
+func libreCodes(languages []LibreLanguage) map[string]string {
+	available := make(map[string]bool)
+	for _, language := range languages {
+		available[language.Code] = true
+	}
+	codes := make(map[string]string)
+	for lang := range gLangs {
+		candidates, ok := libreLangs[lang]
+		if !ok {
+			candidates = []string{lang}
+		}
+		for _, code := range candidates {
+			if available[code] {
+				codes[lang] = code
+				break
+			}
+		}
+	}
+	return codes
+}
+
+// code returns the LibreTranslate code for lang
+func (l *LibreTranslator) code(lang string) (string, error) {
+	codes, err := l.languages()
+	if err != nil {
+		return "", err
+	}
+	code, ok := codes[lang]
+	if !ok {
+		return "", fmt.Errorf("libretranslate: language '%s' is not supported", lang)
+	}
+	return code, nil
+}
+
+func (l *LibreTranslator) Name() string {
+	return "libretranslate"
+}
+
+// translate posts q, a text or a list of texts, to the API and unmarshals the response into v
+func (l *LibreTranslator) translate(q interface{}, source string, target string, v interface{}) error {
+	sourceCode, err := l.code(source)
+	if err != nil {
+		return err
+	}
+	targetCode, err := l.code(target)
+	if err != nil {
+		return err
+	}
+
+	// Prepare JSON body for LibreTranslate API call
+	b, err := json.Marshal(map[string]interface{}{
+		"q":       q,
+		"source":  sourceCode,
+		"target":  targetCode,
+		"format":  "text",
+		"api_key": l.Key,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Make LibreTranslate API Call and unmarshal json response
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	body, err := l.Client.Do("POST", l.Url+"/translate", header, b)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (l *LibreTranslator) Translate(text string, source string, target string) (string, error) {
+	var lt LibreTranslation
+	err := l.translate(text, source, target, &lt)
+	if err != nil {
+		return "", err
+	}
+	if lt.TranslatedText == "" {
+		return "", ErrNoTranslation
+	}
+	return lt.TranslatedText, nil
+}
+
+// TranslateBatch sends all texts as a list in "q" in a single request
+func (l *LibreTranslator) TranslateBatch(texts []string, source string, target string) ([]string, error) {
+	var lt LibreBatchTranslation
+	err := l.translate(texts, source, target, &lt)
+	if err != nil {
+		return nil, err
+	}
+	if len(lt.TranslatedText) != len(texts) {
+		return nil, ErrNoTranslation
+	}
+	return lt.TranslatedText, nil
+}
+
+type LibreDetection struct {
+	Language   string
+	Confidence float64
+}
+
+// Detect posts every text to the detect endpoint, which takes one text at a time
+func (l *LibreTranslator) Detect(texts []string) ([]Detection, error) {
+	codes, err := l.languages()
+	if err != nil {
+		return nil, err
+	}
+	detections := make([]Detection, len(texts))
+	for i, text := range texts {
+		b, err := json.Marshal(map[string]interface{}{
+			"q":       text,
+			"api_key": l.Key,
+		})
+		if err != nil {
+			return nil, err
+		}
+		header := http.Header{}
+		header.Set("Content-Type", "application/json")
+		body, err := l.Client.Do("POST", l.Url+"/detect", header, b)
+		if err != nil {
+			return nil, err
+		}
+		var ld []LibreDetection
+		err = json.Unmarshal(body, &ld)
+		if err != nil {
+			return nil, err
+		}
+		if len(ld) == 0 {
+			return nil, errors.New("libretranslate: no detection returned")
+		}
+
+		// Map the code of the server back to ours, the confidence is a percentage
+		lang := ld[0].Language
+		for code, libre := range codes {
+			if libre == lang {
+				lang = code
+				break
+			}
+		}
+		detections[i] = Detection{Language: lang, Confidence: ld[0].Confidence / 100}
+	}
+	return detections, nil
+}
+
+// Languages returns no languages while the languages of the server can't be loaded
+func (l *LibreTranslator) Languages() []string {
+	codes, _ := l.languages()
+	langs := make([]string, 0, len(codes))
+	for lang := range codes {
+		if _, ok := gLangs[lang]; ok {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
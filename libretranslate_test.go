@@ -0,0 +1,165 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// libreStub returns a local LibreTranslate server that prefixes text with the target code
+func libreStub(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/languages":
+			fmt.Fprint(w, `[{"code":"en","name":"English"},{"code":"de","name":"German"},`+
+				`{"code":"zh","name":"Chinese"},{"code":"he","name":"Hebrew"}]`)
+		case "/translate":
+			var req struct {
+				Q      interface{}
+				Source string
+				Target string
+				ApiKey string `json:"api_key"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			if req.ApiKey != "secret" {
+				w.WriteHeader(403)
+				fmt.Fprint(w, `{"error":"Invalid API key"}`)
+				return
+			}
+			prefix := "[" + req.Source + ">" + req.Target + "] "
+			if q, ok := req.Q.([]interface{}); ok {
+				var translations []string
+				for _, text := range q {
+					translations = append(translations, prefix+text.(string))
+				}
+				json.NewEncoder(w).Encode(map[string][]string{"translatedText": translations})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"translatedText": prefix + req.Q.(string)})
+		case "/detect":
+			fmt.Fprint(w, `[{"confidence":90.0,"language":"he"},{"confidence":10.0,"language":"en"}]`)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+}
+
+func TestLibreTranslate(t *testing.T) {
+	ts := libreStub(t)
+	defer ts.Close()
+
+	l, err := NewLibreTranslator(ts.URL+"/", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	langs := l.Languages()
+	if !reflect.DeepEqual(langs, []string{"de", "en", "iw", "zh-CN"}) {
+		t.Errorf("Unexpected languages: %v", langs)
+	}
+
+	translation, err := l.Translate("Hello", "en", "zh-CN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translation != "[en>zh] Hello" {
+		t.Errorf("Unexpected translation: '%s'", translation)
+	}
+
+	translations, err := l.TranslateBatch([]string{"Hello", "Bye"}, "en", "iw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(translations, []string{"[en>he] Hello", "[en>he] Bye"}) {
+		t.Errorf("Unexpected translations: %v", translations)
+	}
+
+	detections, err := l.Detect([]string{"שלום", "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detections) != 2 || detections[0] != (Detection{Language: "iw", Confidence: 0.9}) {
+		t.Errorf("Unexpected detections: %v", detections)
+	}
+
+	if _, err := l.Translate("Hello", "en", "fr"); err == nil {
+		t.Errorf("Expected an error for an unsupported language")
+	}
+
+	l.Key = "wrong"
+	if _, err := l.Translate("Hello", "en", "de"); err == nil {
+		t.Errorf("Expected an error for an invalid key")
+	}
+}
+
+func TestLibreTranslateUnavailable(t *testing.T) {
+	down := true
+	stub := libreStub(t)
+	defer stub.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(503)
+			return
+		}
+		stub.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	t.Log("Start while the server is down")
+	l, err := NewLibreTranslator(ts.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Client.Retries = 0
+	if langs := l.Languages(); len(langs) != 0 {
+		t.Errorf("Expected no languages, got: %v", langs)
+	}
+	if _, err := l.Translate("Hello", "en", "de"); err == nil {
+		t.Errorf("Expected an error while the languages are not loaded")
+	}
+
+	t.Log("Strings posted while the server is down are translated once it is up")
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = l
+	c := &Collection{}
+	c.Post(&url.Values{"name": {"Libre"}})
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	cs.Post(&url.Values{"string": {"Hello"}})
+	runJobs(t)
+	queued, _ := store.FindJobs([]string{JobQueued})
+	if len(queued) != 1 || queued[0].Error == "" {
+		t.Fatalf("Job should be retried while the languages are not loaded: %v", queued)
+	}
+
+	t.Log("Load the languages once the server is up")
+	down = false
+	if langs := l.Languages(); len(langs) != 0 {
+		t.Errorf("Languages were loaded again before libreRetry: %v", langs)
+	}
+	retry := libreRetry
+	libreRetry = 0
+	defer func() { libreRetry = retry }()
+	runJobs(t)
+	var j Job
+	store.FindJob(queued[0].Id, &j)
+	if j.State != JobDone || len(j.Languages) != 3 || j.Translated["de"] != 1 {
+		t.Errorf("Unexpected Job once the server is up: %v", j)
+	}
+	translation, err := l.Translate("Hello", "en", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translation != "[en>de] Hello" || len(l.Languages()) != 4 {
+		t.Errorf("Unexpected translation '%s' or languages: %v", translation, l.Languages())
+	}
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
@@ -10,16 +11,78 @@ import (
 	"os"
 	"regexp"
 	"runtime"
+	"strconv"
+	"time"
 	"translation.io/rest"
 )
 
-var mongoPath string
-var mongoDb string
-
 // The Router method routes requests to the appropriate Resource
 func Router(path string) rest.Resource {
-	if match, params := rest.MatchRoute("/collections/([a-z0-9]+)/strings/?([a-z0-9]+)?/?", path); match {
+	if match, params := rest.MatchRoute("^/jobs/([a-z0-9]+)/retry/?$", path); match {
+		if bson.IsObjectIdHex(params[1]) {
+			r := &JobRetry{}
+			r.Job.Id = bson.ObjectIdHex(params[1])
+			return r
+		} else {
+			return &rest.NotFound{}
+		}
+	} else if match, params := rest.MatchRoute("^/jobs/?([a-z0-9]+)?/?$", path); match {
+		if params[1] == "" {
+			return &Job{}
+		} else if bson.IsObjectIdHex(params[1]) {
+			return &Job{Id: bson.ObjectIdHex(params[1])}
+		} else {
+			return &rest.NotFound{}
+		}
+	} else if match, params := rest.MatchRoute("^/collections/([a-z0-9]+)/jobs/?$", path); match {
+		if bson.IsObjectIdHex(params[1]) {
+			cj := &CollectionJobs{}
+			cj.Collection.Id = bson.ObjectIdHex(params[1])
+			return cj
+		} else {
+			return &rest.NotFound{}
+		}
+	} else if match, params := rest.MatchRoute("^/collections/([a-z0-9]+)/webhooks/([a-z0-9]+)/deliveries/?$", path); match {
+		if bson.IsObjectIdHex(params[1]) && bson.IsObjectIdHex(params[2]) {
+			wd := &WebhookDeliveries{}
+			wd.Collection.Id = bson.ObjectIdHex(params[1])
+			wd.Webhook.Id = bson.ObjectIdHex(params[2])
+			return wd
+		} else {
+			return &rest.NotFound{}
+		}
+	} else if match, params := rest.MatchRoute("^/collections/([a-z0-9]+)/webhooks/?([a-z0-9]+)?/?$", path); match {
+		if bson.IsObjectIdHex(params[1]) && (params[2] == "" || bson.IsObjectIdHex(params[2])) {
+			cw := &CollectionWebhooks{}
+			cw.Collection.Id = bson.ObjectIdHex(params[1])
+			if params[2] != "" {
+				cw.Webhook.Id = bson.ObjectIdHex(params[2])
+			}
+			return cw
+		} else {
+			return &rest.NotFound{}
+		}
+	} else if match, params := rest.MatchRoute("^/collections/([a-z0-9]+)/keys/([A-Za-z0-9_.\\-]+)/?$", path); match {
 		if bson.IsObjectIdHex(params[1]) {
+			ck := &CollectionKeys{Key: params[2]}
+			ck.Collection.Id = bson.ObjectIdHex(params[1])
+			return ck
+		} else {
+			return &rest.NotFound{}
+		}
+	} else if match, params := rest.MatchRoute("^/collections/([a-z0-9]+)/(strings/([a-z0-9]+)/)?retranslate/?$", path); match {
+		if bson.IsObjectIdHex(params[1]) && (params[3] == "" || bson.IsObjectIdHex(params[3])) {
+			r := &Retranslation{}
+			r.Collection.Id = bson.ObjectIdHex(params[1])
+			if params[3] != "" {
+				r.String.Id = bson.ObjectIdHex(params[3])
+			}
+			return r
+		} else {
+			return &rest.NotFound{}
+		}
+	} else if match, params := rest.MatchRoute("/collections/([a-z0-9]+)/strings/?([a-z0-9]+)?/?", path); match {
+		if bson.IsObjectIdHex(params[1]) && (params[2] == "" || bson.IsObjectIdHex(params[2])) {
 			cs := &CollectionStrings{}
 			cs.Collection.Id = bson.ObjectIdHex(params[1])
 			if len(params) > 1 && bson.IsObjectIdHex(params[2]) {
@@ -39,6 +102,8 @@ func Router(path string) rest.Resource {
 		}
 	} else if match, _ := rest.MatchRoute("/collections/?", path); match {
 		return &Collection{}
+	} else if match, _ := rest.MatchRoute("^/strings/?$", path); match {
+		return &StringSearch{}
 	}
 	return &rest.NotFound{}
 }
@@ -76,28 +141,78 @@ func APIHandler(w http.ResponseWriter, req *http.Request) {
 	path := req.URL.Path
 
 	// Redirect everything else to Docs
-	regex, _ := regexp.Compile("/collections.*")
+	regex, _ := regexp.Compile("^/(collections|jobs|strings).*")
 	if !regex.MatchString(path) {
 		DocsHandler(w, req)
 		return
 	}
 
+	// Stream the Events of a Collection, which keeps the connection open
+	if match, params := rest.MatchRoute("^/collections/([a-z0-9]+)/events/?$", path); match {
+		if !bson.IsObjectIdHex(params[1]) {
+			http.Error(w, rest.NotFoundError().ToJSON(), 404)
+		} else if req.Method != "GET" {
+			http.Error(w, rest.InvalidMethodError(&[]rest.Rel{
+				rest.Rel{"GET": "/collections/" + params[1] + "/events"},
+			}).ToJSON(), 405)
+		} else {
+			EventStream(w, req, bson.ObjectIdHex(params[1]))
+		}
+		return
+	}
+
 	// Default error when method is not found
 	statusCode := 405
 	response = rest.InvalidMethodError(&[]rest.Rel{
+		rest.Rel{"GET": "/collections",
+			"Params": "name, limit, after",
+		},
 		rest.Rel{
 			"POST":   "/collections",
-			"Params": "name",
+			"Params": "name, source",
 		},
 		rest.Rel{"GET": "/collections/{CollectionId}"},
 		rest.Rel{"PUT": "/collections/{CollectionId}",
-			"Params": "name",
+			"Params": "name, source",
 		},
 		rest.Rel{"DELETE": "/collections/{CollectionId}"},
+		rest.Rel{"GET": "/collections/{CollectionId}/strings",
+			"Params": "sort, limit, after, before, q, lang",
+		},
 		rest.Rel{"POST": "/collections/{CollectionId}/strings",
-			"Params": "string",
+			"Params": "string, key, description, screenshot, maxlength",
+		},
+		rest.Rel{"GET": "/collections/{CollectionId}/strings/{StringId}"},
+		rest.Rel{"PUT": "/collections/{CollectionId}/strings/{StringId}",
+			"Params": "lang, translation",
+		},
+		rest.Rel{"DELETE": "/collections/{CollectionId}/strings/{StringId}",
+			"Params": "lang",
+		},
+		rest.Rel{"POST": "/collections/{CollectionId}/retranslate",
+			"Params": "lang, provider, force",
+		},
+		rest.Rel{"POST": "/collections/{CollectionId}/strings/{StringId}/retranslate",
+			"Params": "lang, provider, force",
+		},
+		rest.Rel{"GET": "/collections/{CollectionId}/jobs"},
+		rest.Rel{"GET": "/jobs/{JobId}"},
+		rest.Rel{"POST": "/jobs/{JobId}/retry"},
+		rest.Rel{"GET": "/collections/{CollectionId}/webhooks"},
+		rest.Rel{"POST": "/collections/{CollectionId}/webhooks",
+			"Params": "url, event, secret",
+		},
+		rest.Rel{"DELETE": "/collections/{CollectionId}/webhooks/{WebhookId}"},
+		rest.Rel{"GET": "/collections/{CollectionId}/webhooks/{WebhookId}/deliveries"},
+		rest.Rel{"GET": "/collections/{CollectionId}/keys/{Key}"},
+		rest.Rel{"PUT": "/collections/{CollectionId}/keys/{Key}",
+			"Params": "string, description, screenshot, maxlength",
+		},
+		rest.Rel{"DELETE": "/collections/{CollectionId}/keys/{Key}"},
+		rest.Rel{"GET": "/collections/{CollectionId}/events"},
+		rest.Rel{"GET": "/strings",
+			"Params": "q, lang, limit",
 		},
-		rest.Rel{"DELETE": "/collections/{CollectionId}/strings/{StringId}"},
 	})
 
 	// Retrieve response on allowed methods
@@ -120,14 +235,106 @@ func APIHandler(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// configureTranslators registers every provider that has been configured and picks the Translator,
+// either a single provider with TRANSLATOR or per-language chains with TRANSLATE_ROUTES
+func configureTranslators() error {
+
+	// Timeouts, retries and circuit breakers of the HTTP clients
+	if d, err := time.ParseDuration(os.Getenv("TRANSLATE_TIMEOUT")); err == nil {
+		clientTimeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("TRANSLATE_RETRIES")); err == nil {
+		clientRetries = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("TRANSLATE_BREAKER_FAILURES")); err == nil {
+		breakerThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("TRANSLATE_BREAKER_COOLDOWN")); err == nil {
+		breakerCooldown = d
+	}
+
+	translators["google"] = NewGoogleTranslator(os.Getenv("GTRANSLATE_KEY"))
+	if os.Getenv("DEEPL_KEY") != "" {
+		d, err := NewDeepLTranslator(os.Getenv("DEEPL_KEY"), os.Getenv("DEEPL_FORMALITY"))
+		if err != nil {
+			return err
+		}
+		translators[d.Name()] = d
+	}
+	if os.Getenv("LIBRETRANSLATE_URL") != "" {
+		l, err := NewLibreTranslator(os.Getenv("LIBRETRANSLATE_URL"), os.Getenv("LIBRETRANSLATE_KEY"))
+		if err != nil {
+			return err
+		}
+		translators[l.Name()] = l
+	}
+
+	if os.Getenv("TRANSLATE_ROUTES") != "" {
+		r, err := ParseRoutes(os.Getenv("TRANSLATE_ROUTES"), translators)
+		if err != nil {
+			return err
+		}
+		translator = r
+		return nil
+	}
+
+	name := os.Getenv("TRANSLATOR")
+	if name == "" {
+		name = "google"
+	}
+	t, ok := translators[name]
+	if !ok {
+		return errors.New("Translator '" + name + "' is not configured")
+	}
+	translator = t
+	return nil
+}
+
 func main() {
 
-	if os.Getenv("MONGOHQ_URL") != "" {
-		mongoPath = os.Getenv("MONGOHQ_URL")
-		mongoDb = "app13325198"
+	if os.Getenv("STORE") == "memory" {
+		store = NewMemoryStore()
+	} else if os.Getenv("STORE") == "bolt" {
+		path := os.Getenv("BOLT_PATH")
+		if path == "" {
+			path = "translation.db"
+		}
+		b, err := OpenBoltStore(path)
+		if err != nil {
+			fmt.Println("Could not open " + path + ": " + err.Error())
+			os.Exit(1)
+		}
+		defer b.Close()
+		store = b
+	} else if os.Getenv("MONGOHQ_URL") != "" {
+		store = NewMongoStore(os.Getenv("MONGOHQ_URL"), "app13325198")
 	} else {
-		mongoPath = "127.0.0.1"
-		mongoDb = "transio"
+		store = NewMongoStore("127.0.0.1", "transio")
+	}
+
+	err := configureTranslators()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	workers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil {
+		workers = 4
+	}
+
+	// Webhooks are started first, recovered Jobs publish Events as soon as they run
+	hooks = NewDispatcher()
+	err = hooks.Start()
+	if err != nil {
+		fmt.Println("Could not start webhooks: " + err.Error())
+		os.Exit(1)
+	}
+	jobs = NewJobQueue(workers)
+	err = jobs.Start()
+	if err != nil {
+		fmt.Println("Could not start jobs: " + err.Error())
+		os.Exit(1)
 	}
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
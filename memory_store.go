@@ -0,0 +1,504 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"labix.org/v2/mgo/bson"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps Collections and Strings in memory, which is useful for tests and local development
+type MemoryStore struct {
+	mu          sync.RWMutex
+	collections map[bson.ObjectId]Collection
+	strings     map[bson.ObjectId]String
+	texts       map[string]bson.ObjectId
+	index       map[string]map[bson.ObjectId]bool
+	jobs        map[bson.ObjectId]Job
+	webhooks    map[bson.ObjectId]Webhook
+	deliveries  map[bson.ObjectId]Delivery
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		collections: make(map[bson.ObjectId]Collection),
+		strings:     make(map[bson.ObjectId]String),
+		texts:       make(map[string]bson.ObjectId),
+		index:       make(map[string]map[bson.ObjectId]bool),
+		jobs:        make(map[bson.ObjectId]Job),
+		webhooks:    make(map[bson.ObjectId]Webhook),
+		deliveries:  make(map[bson.ObjectId]Delivery),
+	}
+}
+
+// copyString returns a String that shares no maps with s
+func copyString(s String) String {
+	if s.Translations != nil {
+		translations := make(map[string]string, len(s.Translations))
+		for lang, translation := range s.Translations {
+			translations[lang] = translation
+		}
+		s.Translations = translations
+	}
+	if s.Status != nil {
+		status := make(map[string]TranslationStatus, len(s.Status))
+		for lang, st := range s.Status {
+			status[lang] = st
+		}
+		s.Status = status
+	}
+	s.Keys = append([]string(nil), s.Keys...)
+	return s
+}
+
+// copyCollection returns a Collection that shares no slices or maps with c
+func copyCollection(c Collection) Collection {
+	if c.Strings != nil {
+		strs := make([]String, len(c.Strings))
+		for i, s := range c.Strings {
+			strs[i] = copyString(s)
+		}
+		c.Strings = strs
+	}
+	if c.Overrides != nil {
+		overrides := make(map[string]map[string]Override, len(c.Overrides))
+		for id, langs := range c.Overrides {
+			overrides[id] = make(map[string]Override, len(langs))
+			for lang, o := range langs {
+				overrides[id][lang] = o
+			}
+		}
+		c.Overrides = overrides
+	}
+	c.Keys = append([]MessageKey(nil), c.Keys...)
+	if c.Contexts != nil {
+		contexts := make(map[string]Context, len(c.Contexts))
+		for id, context := range c.Contexts {
+			contexts[id] = context
+		}
+		c.Contexts = contexts
+	}
+	return c
+}
+
+// copyJob returns a Job that shares no slices or maps with j
+func copyJob(j Job) Job {
+	j.StringIds = append([]bson.ObjectId(nil), j.StringIds...)
+	j.Languages = append([]string(nil), j.Languages...)
+	j.Failures = append([]TranslationFailure(nil), j.Failures...)
+	j.Translated = copyCounts(j.Translated)
+	j.Failed = copyCounts(j.Failed)
+	return j
+}
+
+// copyCounts returns a copy of the counts of a Job per language
+func copyCounts(counts map[string]int) map[string]int {
+	if counts == nil {
+		return nil
+	}
+	c := make(map[string]int, len(counts))
+	for lang, n := range counts {
+		c[lang] = n
+	}
+	return c
+}
+
+// copyWebhook returns a Webhook that shares no slices with w
+func copyWebhook(w Webhook) Webhook {
+	w.Events = append([]string(nil), w.Events...)
+	return w
+}
+
+func (m *MemoryStore) FindCollection(id bson.ObjectId, c *Collection) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found, ok := m.collections[id]
+	if !ok {
+		return ErrNotFound
+	}
+	*c = copyCollection(found)
+	return nil
+}
+
+func (m *MemoryStore) FindCollections(name string, after bson.ObjectId, limit int) ([]Collection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var cs []Collection
+	for _, c := range m.collections {
+		if after.Valid() && c.Id <= after {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(c.Name), strings.ToLower(name)) {
+			continue
+		}
+		cs = append(cs, copyCollection(c))
+	}
+	sort.Sort(collectionsById(cs))
+	if len(cs) > limit {
+		cs = cs[:limit]
+	}
+	return cs, nil
+}
+
+func (m *MemoryStore) InsertCollection(c *Collection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !c.Id.Valid() {
+		c.Id = bson.NewObjectId()
+	}
+	c.Modified = time.Now()
+	m.collections[c.Id] = copyCollection(*c)
+	return nil
+}
+
+func (m *MemoryStore) UpdateCollection(c *Collection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.collections[c.Id]; !ok {
+		return ErrNotFound
+	}
+	c.Modified = time.Now()
+	m.collections[c.Id] = copyCollection(*c)
+	return nil
+}
+
+func (m *MemoryStore) RemoveCollection(id bson.ObjectId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.collections[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.collections, id)
+	return nil
+}
+
+func (m *MemoryStore) FindString(id bson.ObjectId, s *String) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found, ok := m.strings[id]
+	if !ok {
+		return ErrNotFound
+	}
+	*s = copyString(found)
+	return nil
+}
+
+func (m *MemoryStore) FindStrings(ids []bson.ObjectId) ([]String, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var strs []String
+	for _, id := range ids {
+		if s, ok := m.strings[id]; ok {
+			strs = append(strs, copyString(s))
+		}
+	}
+	return strs, nil
+}
+
+func (m *MemoryStore) FindStringByText(str string, source string, description string, s *String) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.texts[textKey(str, source, description)]
+	if !ok {
+		return ErrNotFound
+	}
+	*s = copyString(m.strings[id])
+	return nil
+}
+
+func (m *MemoryStore) InsertString(s *String) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Strings are unique by text, source language and description
+	if id, ok := m.texts[textKey(s.String, s.Source, s.Description)]; ok {
+		*s = copyString(m.strings[id])
+		return nil
+	}
+	if !s.Id.Valid() {
+		s.Id = bson.NewObjectId()
+	}
+	m.strings[s.Id] = copyString(*s)
+	m.texts[textKey(s.String, s.Source, s.Description)] = s.Id
+	m.reindex(nil, s)
+	return nil
+}
+
+func (m *MemoryStore) UpdateString(s *String) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.strings[s.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.texts, textKey(old.String, old.Source, old.Description))
+	m.strings[s.Id] = copyString(*s)
+	m.texts[textKey(s.String, s.Source, s.Description)] = s.Id
+	m.reindex(&old, s)
+	return nil
+}
+
+func (m *MemoryStore) RemoveString(id bson.ObjectId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.strings[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.texts, textKey(old.String, old.Source, old.Description))
+	delete(m.strings, id)
+	m.reindex(&old, nil)
+	return nil
+}
+
+func (m *MemoryStore) SetTranslation(id bson.ObjectId, lang string, translation string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.strings[id]
+	if !ok {
+		return ErrNotFound
+	}
+	old := copyString(s)
+	if s.Translations == nil {
+		s.Translations = make(map[string]string)
+	}
+	s.Translations[lang] = translation
+	m.strings[id] = s
+	m.reindex(&old, &s)
+	return nil
+}
+
+func (m *MemoryStore) RemoveTranslation(id bson.ObjectId, lang string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.strings[id]
+	if !ok {
+		return ErrNotFound
+	}
+	old := copyString(s)
+	delete(s.Translations, lang)
+	m.reindex(&old, &s)
+	return nil
+}
+
+// reindex replaces the words of old with the words of s in the index, either can be nil.
+// The caller must hold the write lock.
+func (m *MemoryStore) reindex(old *String, s *String) {
+	if old != nil {
+		for _, token := range stringTokens(old) {
+			delete(m.index[token], old.Id)
+			if len(m.index[token]) == 0 {
+				delete(m.index, token)
+			}
+		}
+	}
+	if s != nil {
+		for _, token := range stringTokens(s) {
+			if m.index[token] == nil {
+				m.index[token] = make(map[bson.ObjectId]bool)
+			}
+			m.index[token][s.Id] = true
+		}
+	}
+}
+
+func (m *MemoryStore) SearchStrings(q string, within []bson.ObjectId, after bson.ObjectId, limit int) ([]String, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	terms := tokenize(q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// Intersect the Strings of every word, starting with the Collection
+	var found map[bson.ObjectId]bool
+	if within != nil {
+		found = make(map[bson.ObjectId]bool)
+		for _, id := range within {
+			found[id] = true
+		}
+	}
+	for _, term := range terms {
+		ids := m.index[term]
+		next := make(map[bson.ObjectId]bool)
+		for id := range ids {
+			if found == nil || found[id] {
+				next[id] = true
+			}
+		}
+		found = next
+	}
+
+	var strs []String
+	for _, id := range searchPage(found, after, limit) {
+		strs = append(strs, copyString(m.strings[id]))
+	}
+	return strs, nil
+}
+
+func (m *MemoryStore) FindJob(id bson.ObjectId, j *Job) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	*j = copyJob(found)
+	return nil
+}
+
+func (m *MemoryStore) FindJobs(states []string) ([]Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var js []Job
+	for _, j := range m.jobs {
+		for _, state := range states {
+			if j.State == state {
+				js = append(js, copyJob(j))
+				break
+			}
+		}
+	}
+	sort.Sort(jobsById(js))
+	return js, nil
+}
+
+func (m *MemoryStore) FindCollectionJobs(id bson.ObjectId) ([]Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var js []Job
+	for _, j := range m.jobs {
+		if j.CollectionId == id {
+			js = append(js, copyJob(j))
+		}
+	}
+	sort.Sort(jobsById(js))
+	return js, nil
+}
+
+func (m *MemoryStore) InsertJob(j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !j.Id.Valid() {
+		j.Id = bson.NewObjectId()
+	}
+	m.jobs[j.Id] = copyJob(*j)
+	return nil
+}
+
+func (m *MemoryStore) UpdateJob(j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[j.Id]; !ok {
+		return ErrNotFound
+	}
+	m.jobs[j.Id] = copyJob(*j)
+	return nil
+}
+
+func (m *MemoryStore) FindWebhook(id bson.ObjectId, w *Webhook) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found, ok := m.webhooks[id]
+	if !ok {
+		return ErrNotFound
+	}
+	*w = copyWebhook(found)
+	return nil
+}
+
+func (m *MemoryStore) FindWebhooks(collectionId bson.ObjectId) ([]Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ws []Webhook
+	for _, w := range m.webhooks {
+		if w.CollectionId == collectionId {
+			ws = append(ws, copyWebhook(w))
+		}
+	}
+	sort.Sort(webhooksById(ws))
+	return ws, nil
+}
+
+func (m *MemoryStore) InsertWebhook(w *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !w.Id.Valid() {
+		w.Id = bson.NewObjectId()
+	}
+	m.webhooks[w.Id] = copyWebhook(*w)
+	return nil
+}
+
+func (m *MemoryStore) RemoveWebhook(id bson.ObjectId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *MemoryStore) FindDelivery(id bson.ObjectId, d *Delivery) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found, ok := m.deliveries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	*d = found
+	return nil
+}
+
+func (m *MemoryStore) FindDeliveries(states []string) ([]Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ds []Delivery
+	for _, d := range m.deliveries {
+		for _, state := range states {
+			if d.State == state {
+				ds = append(ds, d)
+				break
+			}
+		}
+	}
+	sort.Sort(deliveriesById(ds))
+	return ds, nil
+}
+
+func (m *MemoryStore) FindWebhookDeliveries(id bson.ObjectId) ([]Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ds []Delivery
+	for _, d := range m.deliveries {
+		if d.WebhookId == id {
+			ds = append(ds, d)
+		}
+	}
+	sort.Sort(deliveriesById(ds))
+	return ds, nil
+}
+
+func (m *MemoryStore) InsertDelivery(d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !d.Id.Valid() {
+		d.Id = bson.NewObjectId()
+	}
+	m.deliveries[d.Id] = *d
+	return nil
+}
+
+func (m *MemoryStore) UpdateDelivery(d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[d.Id]; !ok {
+		return ErrNotFound
+	}
+	m.deliveries[d.Id] = *d
+	return nil
+}
@@ -0,0 +1,410 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"fmt"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// MongoStore keeps Collections and Strings in MongoDB
+type MongoStore struct {
+	Path    string
+	Db      string
+	mu      sync.Mutex
+	session *mgo.Session
+}
+
+func NewMongoStore(path string, db string) *MongoStore {
+	return &MongoStore{Path: path, Db: db}
+}
+
+// C returns a copied session and the named MongoDB collection, the session must be closed by the caller
+func (m *MongoStore) C(name string) (*mgo.Session, *mgo.Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Dial lazily so that the server can start without a running mongod
+	if m.session == nil {
+		session, err := mgo.Dial(m.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Index all text of the Strings for SearchStrings, mgo can't create text indexes with EnsureIndex.
+		// Words are not stemmed and stop words are kept, like the word index of the other Stores. An
+		// index that was created with other options is replaced.
+		search := bson.D{
+			{Name: "createIndexes", Value: "strings"},
+			{Name: "indexes", Value: []bson.M{{"key": bson.M{"$**": "text"}, "name": "search", "default_language": "none"}}},
+		}
+		err = session.DB(m.Db).Run(search, nil)
+		if err != nil {
+			err = session.DB(m.Db).Run(bson.D{{Name: "dropIndexes", Value: "strings"}, {Name: "index", Value: "search"}}, nil)
+			if err == nil {
+				err = session.DB(m.Db).Run(search, nil)
+			}
+		}
+		if err != nil {
+			session.Close()
+			return nil, nil, err
+		}
+
+		// Strings are unique by text, source language and description, also when they're inserted concurrently.
+		// The index can't be built while duplicates are stored, the Store still works without it.
+		err = session.DB(m.Db).C("strings").EnsureIndex(mgo.Index{
+			Key:    []string{"string", "description", "source"},
+			Unique: true,
+		})
+		if err != nil {
+			fmt.Println("Could not index strings by text: " + err.Error())
+		}
+		m.session = session
+	}
+	session := m.session.Copy()
+	return session, session.DB(m.Db).C(name), nil
+}
+
+// mongoError converts mgo errors into Store errors
+func mongoError(err error) error {
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (m *MongoStore) FindCollection(id bson.ObjectId, c *Collection) error {
+	session, C, err := m.C("collections")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(C.FindId(id).One(c))
+}
+
+func (m *MongoStore) FindCollections(name string, after bson.ObjectId, limit int) ([]Collection, error) {
+	session, C, err := m.C("collections")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	query := bson.M{}
+	if name != "" {
+		query["name"] = bson.RegEx{Pattern: regexp.QuoteMeta(name), Options: "i"}
+	}
+	if after.Valid() {
+		query["_id"] = bson.M{"$gt": after}
+	}
+
+	// Only the ids of the Strings are needed to count them
+	var cs []Collection
+	err = C.Find(query).Select(bson.M{"name": 1, "source": 1, "modified": 1, "strings._id": 1}).Sort("_id").Limit(limit).All(&cs)
+	return cs, mongoError(err)
+}
+
+func (m *MongoStore) InsertCollection(c *Collection) error {
+	session, C, err := m.C("collections")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	c.Modified = time.Now()
+	return mongoError(C.Insert(c))
+}
+
+func (m *MongoStore) UpdateCollection(c *Collection) error {
+	session, C, err := m.C("collections")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	c.Modified = time.Now()
+	return mongoError(C.UpdateId(c.Id, c))
+}
+
+func (m *MongoStore) RemoveCollection(id bson.ObjectId) error {
+	session, C, err := m.C("collections")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(C.RemoveId(id))
+}
+
+func (m *MongoStore) FindString(id bson.ObjectId, s *String) error {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(S.FindId(id).One(s))
+}
+
+func (m *MongoStore) FindStrings(ids []bson.ObjectId) ([]String, error) {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var strs []String
+	err = S.Find(bson.M{"_id": bson.M{"$in": ids}}).All(&strs)
+	return strs, mongoError(err)
+}
+
+// mongoText selects the String with a text, source language and description. Empty descriptions are
+// left out of documents, and so are the sources of Strings that were stored before they had one.
+func mongoText(str string, source string, description string) bson.M {
+	query := bson.M{"string": str, "description": description}
+	if description == "" {
+		query["description"] = bson.M{"$exists": false}
+	}
+	query["source"] = sourceLang(source)
+	if query["source"] == defaultSource {
+		query["source"] = bson.M{"$in": []interface{}{defaultSource, nil}}
+	}
+	return query
+}
+
+func (m *MongoStore) FindStringByText(str string, source string, description string, s *String) error {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(S.Find(mongoText(str, source, description)).One(s))
+}
+
+func (m *MongoStore) InsertString(s *String) error {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// Strings are unique by text, source language and description
+	err = S.Find(mongoText(s.String, s.Source, s.Description)).One(s)
+	if err != mgo.ErrNotFound {
+		return err
+	}
+
+	// Another request inserted the same String in the meantime
+	err = S.Insert(s)
+	if mgo.IsDup(err) {
+		err = S.Find(mongoText(s.String, s.Source, s.Description)).One(s)
+	}
+	return mongoError(err)
+}
+
+func (m *MongoStore) UpdateString(s *String) error {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(S.UpdateId(s.Id, s))
+}
+
+func (m *MongoStore) RemoveString(id bson.ObjectId) error {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(S.RemoveId(id))
+}
+
+func (m *MongoStore) SearchStrings(q string, within []bson.ObjectId, after bson.ObjectId, limit int) ([]String, error) {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	terms := tokenize(q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// Quoted words must all be found, which MongoDB would otherwise treat as alternatives
+	search := ""
+	for _, term := range terms {
+		search += `"` + term + `" `
+	}
+	query := bson.M{"$text": bson.M{"$search": search}}
+	ids := bson.M{}
+	if within != nil {
+		ids["$in"] = within
+	}
+	if after != "" {
+		ids["$gt"] = after
+	}
+	if len(ids) > 0 {
+		query["_id"] = ids
+	}
+	var strs []String
+	err = S.Find(query).Sort("_id").Limit(limit).All(&strs)
+	return strs, mongoError(err)
+}
+
+func (m *MongoStore) SetTranslation(id bson.ObjectId, lang string, translation string) error {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(S.UpdateId(id, bson.M{"$set": bson.M{"translations." + lang: translation}}))
+}
+
+func (m *MongoStore) RemoveTranslation(id bson.ObjectId, lang string) error {
+	session, S, err := m.C("strings")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(S.UpdateId(id, bson.M{"$unset": bson.M{"translations." + lang: ""}}))
+}
+
+func (m *MongoStore) FindJob(id bson.ObjectId, j *Job) error {
+	session, J, err := m.C("jobs")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(J.FindId(id).One(j))
+}
+
+func (m *MongoStore) FindJobs(states []string) ([]Job, error) {
+	session, J, err := m.C("jobs")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var js []Job
+	err = J.Find(bson.M{"state": bson.M{"$in": states}}).Sort("_id").All(&js)
+	return js, mongoError(err)
+}
+
+func (m *MongoStore) FindCollectionJobs(id bson.ObjectId) ([]Job, error) {
+	session, J, err := m.C("jobs")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var js []Job
+	err = J.Find(bson.M{"collectionid": id}).Sort("_id").All(&js)
+	return js, mongoError(err)
+}
+
+func (m *MongoStore) InsertJob(j *Job) error {
+	session, J, err := m.C("jobs")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(J.Insert(j))
+}
+
+func (m *MongoStore) UpdateJob(j *Job) error {
+	session, J, err := m.C("jobs")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(J.UpdateId(j.Id, j))
+}
+
+func (m *MongoStore) FindWebhook(id bson.ObjectId, w *Webhook) error {
+	session, W, err := m.C("webhooks")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(W.FindId(id).One(w))
+}
+
+func (m *MongoStore) FindWebhooks(collectionId bson.ObjectId) ([]Webhook, error) {
+	session, W, err := m.C("webhooks")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var ws []Webhook
+	err = W.Find(bson.M{"collectionid": collectionId}).Sort("_id").All(&ws)
+	return ws, mongoError(err)
+}
+
+func (m *MongoStore) InsertWebhook(w *Webhook) error {
+	session, W, err := m.C("webhooks")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if !w.Id.Valid() {
+		w.Id = bson.NewObjectId()
+	}
+	return mongoError(W.Insert(w))
+}
+
+func (m *MongoStore) RemoveWebhook(id bson.ObjectId) error {
+	session, W, err := m.C("webhooks")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(W.RemoveId(id))
+}
+
+func (m *MongoStore) FindDelivery(id bson.ObjectId, d *Delivery) error {
+	session, D, err := m.C("deliveries")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(D.FindId(id).One(d))
+}
+
+func (m *MongoStore) FindDeliveries(states []string) ([]Delivery, error) {
+	session, D, err := m.C("deliveries")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var ds []Delivery
+	err = D.Find(bson.M{"state": bson.M{"$in": states}}).Sort("_id").All(&ds)
+	return ds, mongoError(err)
+}
+
+func (m *MongoStore) FindWebhookDeliveries(id bson.ObjectId) ([]Delivery, error) {
+	session, D, err := m.C("deliveries")
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var ds []Delivery
+	err = D.Find(bson.M{"webhookid": id}).Sort("_id").All(&ds)
+	return ds, mongoError(err)
+}
+
+func (m *MongoStore) InsertDelivery(d *Delivery) error {
+	session, D, err := m.C("deliveries")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if !d.Id.Valid() {
+		d.Id = bson.NewObjectId()
+	}
+	return mongoError(D.Insert(d))
+}
+
+func (m *MongoStore) UpdateDelivery(d *Delivery) error {
+	session, D, err := m.C("deliveries")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return mongoError(D.UpdateId(d.Id, d))
+}
@@ -3,31 +3,281 @@
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"labix.org/v2/mgo"
+	"encoding/base64"
+	"fmt"
 	"labix.org/v2/mgo/bson"
-	"net/http"
 	"net/url"
-	"os"
+	"sort"
+	"strconv"
+	"time"
 	"translation.io/rest"
 )
 
 type Collection struct {
-	Id      bson.ObjectId "_id"
-	Name    string
-	Strings []String
+	Id       bson.ObjectId `bson:"_id"`
+	Name     string
+	Source   string `bson:",omitempty" json:",omitempty"`
+	Strings  []String
+	Modified time.Time
+
+	// Overrides by String Id and language, layered on top of the shared translations
+	Overrides map[string]map[string]Override `bson:",omitempty" json:",omitempty"`
+
+	// Keys of the Strings, which are shown with every String
+	Keys []MessageKey `bson:",omitempty" json:"-"`
+
+	// Screenshots and maximum lengths by String Id, which differ between the Collections that share a String
+	Contexts map[string]Context `bson:",omitempty" json:"-"`
+}
+
+// A Context is where a String is used in one Collection
+type Context struct {
+	Screenshot string `bson:",omitempty"`
+	MaxLength  int    `bson:",omitempty"`
+}
+
+// Strings are in English unless their Collection has another source language
+const defaultSource = "en"
+
+// sourceLang returns the source language of a Collection, String or Job, which is empty when it was
+// stored before the source language could be chosen
+func sourceLang(lang string) string {
+	if lang == "" {
+		return defaultSource
+	}
+	return lang
+}
+
+// Collections with an automatic source language detect the language of every String
+const autoSource = "auto"
+
+// without returns langs, except for lang
+func without(langs []string, lang string) []string {
+	var others []string
+	for _, l := range langs {
+		if l != lang {
+			others = append(others, l)
+		}
+	}
+	return others
+}
+
+// targetLangs returns the languages of t, except for the source language
+func targetLangs(t Translator, source string) []string {
+	return without(t.Languages(), sourceLang(source))
+}
+
+// sourceParam validates the source param, which may be empty or auto when the translator can detect languages
+func sourceParam(v *url.Values) (string, rest.APIResponse) {
+	source := v.Get("source")
+	if source == autoSource {
+		if !canDetect(translator) {
+			_, res := invalidParam("source", "The translator can't detect the source language.")
+			return "", res
+		}
+		return source, nil
+	}
+	if _, ok := gLangs[source]; source != "" && !ok {
+		_, res := invalidParam("source", "The source language '"+source+"' is not supported.")
+		return "", res
+	}
+	return source, nil
+}
+
+// collectionsById sorts Collections in the order they were created
+type collectionsById []Collection
+
+func (cs collectionsById) Len() int           { return len(cs) }
+func (cs collectionsById) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+func (cs collectionsById) Less(i, j int) bool { return cs[i].Id < cs[j].Id }
+
+// CollectionSummary is a Collection in a listing, its Strings are only counted
+type CollectionSummary struct {
+	Id          bson.ObjectId
+	Name        string
+	Source      string `json:",omitempty"`
+	StringCount int
+	Modified    time.Time
+}
+
+// An Override is a reviewed translation of a String that only applies to one Collection
+type Override struct {
+	Translation string
+	Updated     time.Time
 }
 
 type String struct {
-	Id           bson.ObjectId "_id"
+	Id           bson.ObjectId `bson:"_id"`
 	String       string
 	Translations map[string]string
+	Status       map[string]TranslationStatus
+
+	// The language of the text, set from the Collection that added the String. Collections with an
+	// automatic source language detect it, with a Confidence between 0 and 1.
+	Source     string  `bson:",omitempty" json:",omitempty"`
+	Confidence float64 `bson:",omitempty" json:",omitempty"`
+
+	// Context for translators. The same text with another Description is another String, e.g. "Open"
+	// as a verb or an adjective. Screenshot is the URL of an image that shows where the text is used,
+	// it and MaxLength are read from the Context in the Collection.
+	Description string `bson:",omitempty" json:",omitempty"`
+	Screenshot  string `bson:"-" json:",omitempty"`
+	MaxLength   int    `bson:"-" json:",omitempty"`
+
+	// Keys within the Collection the String was read from
+	Keys []string `bson:"-" json:",omitempty"`
 }
 
-type Translation struct {
-	Language    string
-	Translation string
+// States of the translation of a String into a language, languages that were not attempted have no state
+const (
+	StatusPending  = "pending"
+	StatusMachine  = "machine"
+	StatusFailed   = "failed"
+	StatusReviewed = "reviewed"
+)
+
+type TranslationStatus struct {
+	State   string
+	Reason  string `bson:",omitempty" json:",omitempty"`
+	Updated time.Time
+}
+
+// SetTranslations stores the machine translations for langs, languages without a translation are marked
+// as failed with the reason from reasons. Reviewed translations are Overrides of a Collection and
+// are not affected.
+func (s *String) SetTranslations(langs []string, translations map[string]string, reasons map[string]string) {
+	if s.Translations == nil {
+		s.Translations = make(map[string]string)
+	}
+	if s.Status == nil {
+		s.Status = make(map[string]TranslationStatus)
+	}
+	now := time.Now()
+	for _, lang := range langs {
+		if translation, ok := translations[lang]; ok {
+			s.Translations[lang] = translation
+			s.Status[lang] = TranslationStatus{State: StatusMachine, Updated: now}
+			continue
+		}
+		reason := reasons[lang]
+		if reason == "" {
+			reason = ErrNoTranslation.Error()
+		}
+		s.Status[lang] = TranslationStatus{State: StatusFailed, Reason: reason, Updated: now}
+	}
+}
+
+// SetPending marks langs as pending
+func (s *String) SetPending(langs []string) {
+	if s.Status == nil {
+		s.Status = make(map[string]TranslationStatus)
+	}
+	now := time.Now()
+	for _, lang := range langs {
+		s.Status[lang] = TranslationStatus{State: StatusPending, Updated: now}
+	}
+}
+
+// SetOverride customizes the translation of a String for this Collection only, as Strings are shared
+func (c *Collection) SetOverride(id bson.ObjectId, lang string, translation string) {
+	if c.Overrides == nil {
+		c.Overrides = make(map[string]map[string]Override)
+	}
+	if c.Overrides[id.Hex()] == nil {
+		c.Overrides[id.Hex()] = make(map[string]Override)
+	}
+	c.Overrides[id.Hex()][lang] = Override{Translation: translation, Updated: time.Now()}
+}
+
+// RemoveOverride returns false when the String had no Override for lang
+func (c *Collection) RemoveOverride(id bson.ObjectId, lang string) bool {
+	if _, ok := c.Overrides[id.Hex()][lang]; !ok {
+		return false
+	}
+	delete(c.Overrides[id.Hex()], lang)
+	if len(c.Overrides[id.Hex()]) == 0 {
+		delete(c.Overrides, id.Hex())
+	}
+	return true
+}
+
+// SetContext replaces the screenshot and the maximum length of a String when they're given
+func (c *Collection) SetContext(id bson.ObjectId, screenshot string, maxLength int) bool {
+	context := c.Contexts[id.Hex()]
+	if (screenshot == "" || screenshot == context.Screenshot) && (maxLength == 0 || maxLength == context.MaxLength) {
+		return false
+	}
+	if screenshot != "" {
+		context.Screenshot = screenshot
+	}
+	if maxLength != 0 {
+		context.MaxLength = maxLength
+	}
+	if c.Contexts == nil {
+		c.Contexts = make(map[string]Context)
+	}
+	c.Contexts[id.Hex()] = context
+	return true
+}
+
+// Apply adds the keys and the Context of s and layers the Overrides of the Collection on top of the
+// shared translations of s
+func (c *Collection) Apply(s *String) {
+	s.Keys = c.KeysOf(s.Id)
+	s.Screenshot = c.Contexts[s.Id.Hex()].Screenshot
+	s.MaxLength = c.Contexts[s.Id.Hex()].MaxLength
+	overrides := c.Overrides[s.Id.Hex()]
+	if len(overrides) == 0 {
+		return
+	}
+	translations := make(map[string]string)
+	for lang, translation := range s.Translations {
+		translations[lang] = translation
+	}
+	status := make(map[string]TranslationStatus)
+	for lang, st := range s.Status {
+		status[lang] = st
+	}
+	for lang, o := range overrides {
+		translations[lang] = o.Translation
+		status[lang] = TranslationStatus{State: StatusReviewed, Updated: o.Updated}
+	}
+	s.Translations = translations
+	s.Status = status
+}
+
+// HasString returns true when the String with id is part of the Collection
+func (c *Collection) HasString(id bson.ObjectId) bool {
+	for _, s := range c.Strings {
+		if s.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Refresh replaces the embedded Strings with their latest version, as Strings are shared between
+// Collections and may have been retranslated after they were added, and applies the Overrides
+func (c *Collection) Refresh() error {
+	ids := make([]bson.ObjectId, len(c.Strings))
+	for i, s := range c.Strings {
+		ids[i] = s.Id
+	}
+	strs, err := store.FindStrings(ids)
+	if err != nil {
+		return err
+	}
+	fresh := make(map[bson.ObjectId]String)
+	for _, s := range strs {
+		fresh[s.Id] = s
+	}
+	for i, s := range c.Strings {
+		if f, ok := fresh[s.Id]; ok {
+			c.Strings[i] = f
+		}
+		c.Apply(&c.Strings[i])
+	}
+	return nil
 }
 
 // Implements APIResponse interface
@@ -37,41 +287,83 @@ func (c *Collection) ToJSON() string {
 
 func (c *Collection) Get(v *url.Values) (int, rest.APIResponse) {
 
-	// Initialize DB
-	session, err := mgo.Dial(mongoPath)
-	if err != nil {
-		return 500, rest.ServerError()
-	}
-	C := session.DB(mongoDb).C("collections")
-	defer session.Close()
-
 	if !c.Id.Valid() {
 
-		// GET on /collections (without an ID) is not allowed
-		return 405, rest.InvalidMethodError(&[]rest.Rel{
+		// List collections, filtered by name
+		// TODO: only list the collections of the caller once there is authentication
+		limit, ok := limitParam(v)
+		if !ok {
+			return invalidParam("limit", limitMessage)
+		}
+		var after bson.ObjectId
+		if v.Get("after") != "" {
+			if !bson.IsObjectIdHex(v.Get("after")) {
+				return invalidParam("after", "The cursor is not valid.")
+			}
+			after = bson.ObjectIdHex(v.Get("after"))
+		}
+
+		// Find one more to know if there is a next page
+		cs, err := store.FindCollections(v.Get("name"), after, limit+1)
+		if err != nil {
+			return 500, rest.ServerError()
+		}
+		more := len(cs) > limit
+		if more {
+			cs = cs[:limit]
+		}
+		summaries := make([]CollectionSummary, len(cs))
+		for i, found := range cs {
+			summaries[i] = CollectionSummary{
+				Id:          found.Id,
+				Name:        found.Name,
+				Source:      found.Source,
+				StringCount: len(found.Strings),
+				Modified:    found.Modified,
+			}
+		}
+
+		next := []rest.Rel{
+			rest.Rel{"GET": "/collections/{CollectionId}"},
 			rest.Rel{"POST": "/collections",
-				"Params": "name",
+				"Params": "name, source",
 			},
-		})
+		}
+		if more {
+			query := url.Values{"limit": {strconv.Itoa(limit)}, "after": {cs[len(cs)-1].Id.Hex()}}
+			if v.Get("name") != "" {
+				query.Set("name", v.Get("name"))
+			}
+			next = append([]rest.Rel{rest.Rel{"GET": "/collections?" + query.Encode()}}, next...)
+		}
+		return 200, &rest.APISuccess{
+			"Collections": summaries,
+			"Next":        &next,
+		}
 
 	} else {
 
 		// Return single collection
-		err = C.FindId(c.Id).One(&c)
-		if err != nil && err != mgo.ErrNotFound {
-			return 500, rest.ServerError()
+		err := store.FindCollection(c.Id, c)
+		if err != nil {
+			return storeError(err)
 		}
-		if err == mgo.ErrNotFound {
-			return 404, rest.NotFoundError()
+		err = c.Refresh()
+		if err != nil {
+			return 500, rest.ServerError()
 		}
 		return 200, &rest.APISuccess{
 			"Collection": c,
 			"Next": &[]rest.Rel{
 				rest.Rel{
 					"PUT":    "/collections/" + c.Id.Hex(),
-					"Params": "name",
+					"Params": "name, source",
 				},
 				rest.Rel{"DELETE": "/collections/" + c.Id.Hex()},
+				rest.Rel{
+					"GET":    "/collections/" + c.Id.Hex() + "/strings",
+					"Params": "sort, limit, after, before, q, lang",
+				},
 				rest.Rel{
 					"POST":   "/collections/" + c.Id.Hex() + "/strings",
 					"Params": "string",
@@ -80,9 +372,6 @@ func (c *Collection) Get(v *url.Values) (int, rest.APIResponse) {
 			},
 		}
 	}
-
-	// Return Not Found Error
-	return 404, rest.NotFoundError()
 }
 
 func (c *Collection) Post(v *url.Values) (int, rest.APIResponse) {
@@ -91,7 +380,7 @@ func (c *Collection) Post(v *url.Values) (int, rest.APIResponse) {
 	name := v.Get("name")
 	if name == "" {
 		return 422, &rest.APIError{
-			rest.Error: rest.ErrorMsg{
+			Error: rest.ErrorMsg{
 				Type:    "invalid-name",
 				Message: "A non-empty name is required.",
 				Code:    422,
@@ -100,27 +389,18 @@ func (c *Collection) Post(v *url.Values) (int, rest.APIResponse) {
 		}
 	}
 
-	// Initialize DB
-	session, err := mgo.Dial(mongoPath)
-	if err != nil {
-		return 500, rest.ServerError()
+	// Validate source language, English by default
+	source, res := sourceParam(v)
+	if res != nil {
+		return 422, res
 	}
-	C := session.DB(mongoDb).C("collections")
-	defer session.Close()
-
-	/*	
-		// Check if a collection with the same name already exists
-		err = C.Find(bson.M{"name": name}).One(&c)
-		if err != nil && err != mgo.ErrNotFound {
-			return 500, rest.ServerError()
-		}
-	*/
 
 	if c.Name == "" {
 		// Insert new Collection into DB
 		c.Id = bson.NewObjectId()
 		c.Name = name
-		err = C.Insert(c)
+		c.Source = sourceLang(source)
+		err := store.InsertCollection(c)
 		if err != nil {
 			return 500, rest.ServerError()
 		}
@@ -132,7 +412,7 @@ func (c *Collection) Post(v *url.Values) (int, rest.APIResponse) {
 		"Next": &[]rest.Rel{
 			rest.Rel{"GET": "/collections/" + c.Id.Hex()},
 			rest.Rel{"PUT": "/collections/" + c.Id.Hex(),
-				"Params": "name",
+				"Params": "name, source",
 			},
 			rest.Rel{"DELETE": "/collections/" + c.Id.Hex()},
 			rest.Rel{"POST": "/collections/" + c.Id.Hex() + "/strings",
@@ -150,19 +430,11 @@ func (c *Collection) Put(v *url.Values) (int, rest.APIResponse) {
 		return 404, rest.NotFoundError()
 	}
 
-	// Initialize DB
-	session, err := mgo.Dial(mongoPath)
-	if err != nil {
-		return 500, rest.ServerError()
-	}
-	C := session.DB(mongoDb).C("collections")
-	defer session.Close()
-
 	// Validate Name
 	newName := v.Get("name")
 	if newName == "" {
 		return 422, &rest.APIError{
-			rest.Error: rest.ErrorMsg{
+			Error: rest.ErrorMsg{
 				Type:    "invalid-name",
 				Message: "A non-empty name is required.",
 				Code:    422,
@@ -171,14 +443,34 @@ func (c *Collection) Put(v *url.Values) (int, rest.APIResponse) {
 		}
 	}
 
+	// Validate source language, which can't change once the Collection has Strings in it
+	source, res := sourceParam(v)
+	if res != nil {
+		return 422, res
+	}
+	l := lockCollection(c.Id)
+	l.Lock()
+	defer l.Unlock()
+	err := store.FindCollection(c.Id, c)
+	if err != nil {
+		return storeError(err)
+	}
+	if source != "" && source != sourceLang(c.Source) {
+		if len(c.Strings) > 0 {
+			return invalidParam("source", "The source language can't be changed once the Collection has strings.")
+		}
+		c.Source = source
+	}
+
 	// Update Collection
 	c.Name = newName
-	err = C.UpdateId(c.Id, c)
-	if err != nil && err != mgo.ErrNotFound {
-		return 500, rest.ServerError()
+	err = store.UpdateCollection(c)
+	if err != nil {
+		return storeError(err)
 	}
-	if err == mgo.ErrNotFound {
-		return 404, rest.NotFoundError()
+	err = c.Refresh()
+	if err != nil {
+		return 500, rest.ServerError()
 	}
 
 	// Return Collection
@@ -197,24 +489,16 @@ func (c *Collection) Put(v *url.Values) (int, rest.APIResponse) {
 
 func (c *Collection) Delete(v *url.Values) (int, rest.APIResponse) {
 
-	// Initialize DB
-	session, err := mgo.Dial(mongoPath)
-	if err != nil {
-		return 500, rest.ServerError()
-	}
-	C := session.DB(mongoDb).C("collections")
-	defer session.Close()
-
 	// Remove Collection
-	err = C.RemoveId(c.Id)
-	if err != nil && err != mgo.ErrNotFound {
+	err := store.RemoveCollection(c.Id)
+	if err != nil && err != ErrNotFound {
 		return 500, rest.ServerError()
 	}
 	return 200, &rest.APISuccess{
 		"Success": true,
 		"Next": &[]rest.Rel{
 			rest.Rel{"POST": "/collections",
-				"Params": "name",
+				"Params": "name, source",
 			},
 		},
 	}
@@ -230,13 +514,231 @@ func (c *CollectionStrings) ToJSON() string {
 	return rest.ParseAPIResponse(c)
 }
 
+// Number of Strings per page when listing the Strings of a Collection
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// stringsBy returns whether a sorts before b, ties are broken by Id so that every String has a
+// unique position that a cursor can point to
+var stringsBy = map[string]func(a, b *String) bool{
+	"created": func(a, b *String) bool {
+		return a.Id < b.Id
+	},
+	"text": func(a, b *String) bool {
+		if a.String != b.String {
+			return a.String < b.String
+		}
+		return a.Id < b.Id
+	},
+}
+
+type sortedStrings struct {
+	strs []String
+	less func(a, b *String) bool
+}
+
+func (s sortedStrings) Len() int           { return len(s.strs) }
+func (s sortedStrings) Swap(i, j int)      { s.strs[i], s.strs[j] = s.strs[j], s.strs[i] }
+func (s sortedStrings) Less(i, j int) bool { return s.less(&s.strs[i], &s.strs[j]) }
+
+// encodeCursor returns an opaque cursor that points to the position of s
+func encodeCursor(s *String) string {
+	return base64.URLEncoding.EncodeToString([]byte(s.Id.Hex() + s.String))
+}
+
+// decodeCursor returns the position a cursor points to, which remains valid when its String is removed
+func decodeCursor(cursor string) (*String, bool) {
+	b, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil || len(b) < 24 || !bson.IsObjectIdHex(string(b[:24])) {
+		return nil, false
+	}
+	return &String{Id: bson.ObjectIdHex(string(b[:24])), String: string(b[24:])}, true
+}
+
+var limitMessage = "The limit must be between 1 and " + strconv.Itoa(maxLimit) + "."
+
+// limitParam returns the limit param or the default, it's false when the limit is out of range
+func limitParam(v *url.Values) (int, bool) {
+	if v.Get("limit") == "" {
+		return defaultLimit, true
+	}
+	limit, err := strconv.Atoi(v.Get("limit"))
+	return limit, err == nil && limit >= 1 && limit <= maxLimit
+}
+
+// sortStrings sorts strs by one of stringsBy
+func sortStrings(strs []String, by string) {
+	sort.Sort(sortedStrings{strs, stringsBy[by]})
+}
+
+// invalidParam returns the error for a param with an unexpected value
+func invalidParam(param string, message string) (int, rest.APIResponse) {
+	return 422, &rest.APIError{
+		Error: rest.ErrorMsg{
+			Type:    "invalid-" + param,
+			Message: message,
+			Code:    422,
+			Param:   []string{param},
+		},
+	}
+}
+
+// contextParams validates the description, screenshot and maxlength of n strings, which are optional
+// but needed for every string when they're given. The context is returned as Strings without text.
+func contextParams(v *url.Values, n int) ([]String, rest.APIResponse) {
+	contexts := make([]String, n)
+	for _, param := range []string{"description", "screenshot", "maxlength"} {
+		values := (*v)[param]
+		if len(values) == 0 {
+			continue
+		}
+		if len(values) != n {
+			_, res := invalidParam(param, "Every string needs a "+param+" when it's given.")
+			return nil, res
+		}
+		for i, value := range values {
+			switch {
+			case param == "description":
+				contexts[i].Description = value
+			case value == "":
+			case param == "screenshot":
+				u, err := url.Parse(value)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					_, res := invalidParam(param, "The screenshot '"+value+"' is not an absolute http or https url.")
+					return nil, res
+				}
+				contexts[i].Screenshot = value
+			case param == "maxlength":
+				max, err := strconv.Atoi(value)
+				if err != nil || max < 1 {
+					_, res := invalidParam(param, "The maxlength '"+value+"' is not a positive number.")
+					return nil, res
+				}
+				contexts[i].MaxLength = max
+			}
+		}
+	}
+	return contexts, nil
+}
+
 func (c *CollectionStrings) Get(v *url.Values) (int, rest.APIResponse) {
-	return 405, rest.InvalidMethodError(&[]rest.Rel{
-		rest.Rel{"POST": "/collections/" + c.Collection.Id.Hex() + "/strings",
+
+	// Find Collection
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+
+	// Return single String with all its Translations
+	if c.String.Id.Valid() {
+		if !c.Collection.HasString(c.String.Id) {
+			return 404, rest.NotFoundError()
+		}
+		err = store.FindString(c.String.Id, &c.String)
+		if err != nil {
+			return storeError(err)
+		}
+		c.Collection.Apply(&c.String)
+		path := "/collections/" + c.Collection.Id.Hex() + "/strings/" + c.String.Id.Hex()
+		return 200, &rest.APISuccess{
+			"String": c.String,
+			"Next": &[]rest.Rel{
+				rest.Rel{"PUT": path,
+					"Params": "lang, translation",
+				},
+				rest.Rel{"DELETE": path},
+				rest.Rel{"POST": path + "/retranslate",
+					"Params": "lang, provider, force",
+				},
+				rest.Rel{"GET": "/collections/" + c.Collection.Id.Hex() + "/strings"},
+			},
+		}
+	}
+
+	// Search the Strings
+	if v.Get("q") != "" {
+		return c.Search(v)
+	}
+
+	// List the latest version of the Strings
+	err = c.Collection.Refresh()
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+
+	// Validate sort, limit and cursors
+	by := v.Get("sort")
+	if by == "" {
+		by = "created"
+	}
+	less, known := stringsBy[by]
+	if !known {
+		return invalidParam("sort", "Strings can be sorted by 'created' or 'text'.")
+	}
+	limit, ok := limitParam(v)
+	if !ok {
+		return invalidParam("limit", limitMessage)
+	}
+	var after, before *String
+	if v.Get("after") != "" && v.Get("before") != "" {
+		return invalidParam("cursor", "Either after or before can be given, not both.")
+	}
+	if v.Get("after") != "" {
+		if after, ok = decodeCursor(v.Get("after")); !ok {
+			return invalidParam("cursor", "The cursor is not valid.")
+		}
+	}
+	if v.Get("before") != "" {
+		if before, ok = decodeCursor(v.Get("before")); !ok {
+			return invalidParam("cursor", "The cursor is not valid.")
+		}
+	}
+
+	// Find the page, counting from the cursor
+	strs := c.Collection.Strings
+	sortStrings(strs, by)
+	start, end := 0, len(strs)
+	if after != nil {
+		start = sort.Search(len(strs), func(i int) bool { return less(after, &strs[i]) })
+		if end > start+limit {
+			end = start + limit
+		}
+	} else if before != nil {
+		end = sort.Search(len(strs), func(i int) bool { return !less(&strs[i], before) })
+		if start < end-limit {
+			start = end - limit
+		}
+	} else if end > limit {
+		end = limit
+	}
+	page := strs[start:end]
+	if page == nil {
+		page = []String{}
+	}
+
+	path := "/collections/" + c.Collection.Id.Hex() + "/strings"
+	next := []rest.Rel{
+		rest.Rel{"POST": path,
 			"Params": "string",
 		},
-		rest.Rel{"DELETE": "/collections/" + c.Collection.Id.Hex() + "/strings/{StringId}"},
-	})
+		rest.Rel{"DELETE": path + "/{StringId}"},
+	}
+	response := rest.APISuccess{
+		"Strings": page,
+		"Total":   len(strs),
+	}
+	if end < len(strs) && len(page) > 0 {
+		query := url.Values{"sort": {by}, "limit": {strconv.Itoa(limit)}, "after": {encodeCursor(&page[len(page)-1])}}
+		next = append([]rest.Rel{rest.Rel{"GET": path + "?" + query.Encode()}}, next...)
+	}
+	if start > 0 && len(page) > 0 {
+		query := url.Values{"sort": {by}, "limit": {strconv.Itoa(limit)}, "before": {encodeCursor(&page[0])}}
+		response["Prev"] = &[]rest.Rel{rest.Rel{"GET": path + "?" + query.Encode()}}
+	}
+	response["Next"] = &next
+	return 200, &response
 }
 
 func (c *CollectionStrings) Post(v *url.Values) (int, rest.APIResponse) {
@@ -246,206 +748,343 @@ func (c *CollectionStrings) Post(v *url.Values) (int, rest.APIResponse) {
 		return 404, rest.NotFoundError()
 	}
 
-	// Initialize DB
-	session, err := mgo.Dial(mongoPath)
+	// Find Collection, which is locked until the new Strings are added to it
+	l := lockCollection(c.Collection.Id)
+	l.Lock()
+	defer l.Unlock()
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
 	if err != nil {
-		return 500, rest.ServerError()
+		return storeError(err)
 	}
-	C := session.DB(mongoDb).C("collections")
-	defer session.Close()
 
-	// Find Collection
-	err = C.FindId(c.Collection.Id).One(&c.Collection)
-	if err != nil && err != mgo.ErrNotFound {
-		return 500, rest.ServerError()
+	// Validate strings, several strings can be posted at once
+	strs := (*v)["string"]
+	if len(strs) == 0 {
+		strs = []string{""}
 	}
-	if err == mgo.ErrNotFound {
-		return 404, rest.NotFoundError()
+	for _, str := range strs {
+		if str == "" {
+			return 422, &rest.APIError{
+				Error: rest.ErrorMsg{
+					Type:    "invalid-string",
+					Message: "A non-empty string is required.",
+					Code:    422,
+					Param:   []string{"string"},
+				},
+			}
+		}
 	}
 
-	// Validate string
-	str := v.Get("string")
-	if str == "" {
-		return 422, &rest.APIError{
-			rest.Error: rest.ErrorMsg{
-				Type:    "invalid-string",
-				Message: "A non-empty string is required.",
-				Code:    422,
-				Param:   []string{"string"},
-			},
+	// Validate keys, which are optional but needed for every string when they're given
+	keys := (*v)["key"]
+	if len(keys) > 0 && len(keys) != len(strs) {
+		return invalidKey("Every string needs a key when keys are given.")
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !keyRegexp.MatchString(key) {
+			return invalidKey("The key '" + key + "' may only contain letters, digits, dots, dashes and underscores.")
 		}
+		if seen[key] {
+			return invalidKey("The key '" + key + "' is given more than once.")
+		}
+		seen[key] = true
 	}
 
-	// Init new String struct
-	s := String{}
-	existingString := false
+	// Validate the context for translators
+	contexts, res := contextParams(v, len(strs))
+	if res != nil {
+		return 422, res
+	}
 
-	// Search for similar string in Collection Strings array (makes "POST" idempotent)
-	if len(c.Collection.Strings) > 0 {
-		for _, Item := range c.Collection.Strings {
-			if Item.String == str {
-				s.Id = Item.Id
-				s.String = str
-				existingString = true
-				break
+	// Detect the language of every string when the Collection has an automatic source language
+	source := sourceLang(c.Collection.Source)
+	detections := make([]Detection, len(strs))
+	if source == autoSource {
+		detections, err = detect(translator, strs)
+		if err == ErrNoDetector {
+			return invalidParam("source", "The translator can't detect the source language.")
+		}
+		if err != nil {
+			fmt.Println("Could not detect the language of strings: " + err.Error())
+			return 500, rest.ServerError()
+		}
+		for i, d := range detections {
+			if _, ok := gLangs[d.Language]; !ok {
+				return invalidParam("string", "The language '"+d.Language+"' of '"+strs[i]+"' is not supported.")
 			}
 		}
+	} else {
+		for i := range detections {
+			detections[i].Language = source
+		}
 	}
 
-	// Search for same String in DB
-	S := session.DB(mongoDb).C("strings")
-	err = S.Find(bson.M{"string": str}).One(&s)
-	if err != nil && err != mgo.ErrNotFound {
-		return 500, rest.ServerError()
-	}
+	// Search for same Strings in DB, and remember the new ones
+	result := make([]String, len(strs))
+	var texts []string
+	created := make(map[string]int)
+	for i, str := range strs {
+		context := contexts[i]
+		text := textKey(str, detections[i].Language, context.Description)
+		if _, ok := created[text]; ok {
+			continue
+		}
+		err = store.FindStringByText(str, detections[i].Language, context.Description, &result[i])
+		if err == ErrNotFound {
+			result[i] = String{Description: context.Description}
+			result[i].Id = bson.NewObjectId()
+			result[i].String = str
+			result[i].Source = detections[i].Language
+			result[i].Confidence = detections[i].Confidence
+			created[text] = i
+			texts = append(texts, text)
+			continue
+		}
+		if err != nil {
+			return 500, rest.ServerError()
+		}
 
-	// Create new String
-	if s.Id == "" {
+	}
 
-		// Set string
-		s.Id = bson.NewObjectId()
-		s.String = str
+	// Create new Strings, they are translated into x languages in the background!
+	var job *Job
+	if len(texts) > 0 {
+		langs := targetLangs(translator, source)
+		job = &Job{CollectionId: c.Collection.Id, Source: source, Languages: langs}
 
-		// Translate string into x languages!
-		gTranslateUrl := "https://www.googleapis.com/language/translate/v2"
-		type GTranslation struct {
-			Data struct {
-				Translations []struct {
-					TranslatedText string
-				}
+		// Insert new strings into strings DB
+		for _, text := range texts {
+			i := created[text]
+			result[i].SetPending(without(langs, result[i].Source))
+			err = store.InsertString(&result[i])
+			if err != nil {
+				return 500, rest.ServerError()
 			}
+			job.StringIds = append(job.StringIds, result[i].Id)
 		}
 
-		// Create channel
-		ch := make(chan Translation)
-
-		// Loop through languages
-		it := 0
-		for lang := range gLangs {
-
-			// Create a goroutine closure for every translation and collect the results into the channel
-			go func(lang string, ch chan Translation) {
-
-				// Initialize Translation struct t
-				var t Translation
-
-				// Prepare Values for GTranslate API call
-				v := &url.Values{}
-				v.Set("key", os.Getenv("GTRANSLATE_KEY"))
-				v.Set("q", s.String)
-				v.Set("source", "en")
-				v.Set("target", lang)
-				v.Set("prettyprint", "false")
-
-				// Make GTranslate API Call and unmarshal json response
-				url := gTranslateUrl + "?" + v.Encode()
-				r, err := http.Get(url)
-				if err != nil {
-					ch <- t
-					return // abort mission
-				}
-
-				body, err := ioutil.ReadAll(r.Body)
-				if err != nil {
-					ch <- t
-					return // abort mission
-				}
-				var g GTranslation
-				err = json.Unmarshal(body, &g)
-				if err != nil {
-					ch <- t
-					return // abort mission
-				}
-				// If a translation is returned, set values of t
-				if len(g.Data.Translations) > 0 {
-					t = Translation{
-						Language:    lang,
-						Translation: g.Data.Translations[0].TranslatedText,
-					}
-				}
+		// Duplicates in the request share the inserted String
+		for i, str := range strs {
+			if j, ok := created[textKey(str, detections[i].Language, contexts[i].Description)]; ok {
+				result[i] = result[j]
+			}
+		}
+	}
 
-				// Return Translation to chan
-				ch <- t
+	// Add Strings to Collection (makes "POST" idempotent) and Update Collection
+	var added []String
+	for _, s := range result {
+		if !c.Collection.HasString(s.Id) {
+			c.Collection.Strings = append(c.Collection.Strings, s)
+			added = append(added, s)
+		}
+	}
 
-			}(lang, ch)
-			it++
+	// A new screenshot or maxlength replaces the one the String has in this Collection only
+	changed := false
+	for i, s := range result {
+		if c.Collection.SetContext(s.Id, contexts[i].Screenshot, contexts[i].MaxLength) {
+			changed = true
 		}
-		s.Translations = make(map[string]string)
+	}
 
-		// Wait for the goroutines to finish and save translations into String
-		for i := 0; i < it; i++ {
-			translation := <-ch
-			if translation.Translation != "" {
-				s.Translations[translation.Language] = translation.Translation
-			}
+	// Bind all keys first, a String that lost its last key to a new text is replaced by it unless it
+	// is part of this request
+	var unbound []bson.ObjectId
+	for i, key := range keys {
+		old := c.Collection.BindKey(key, result[i].Id)
+		if old.Valid() && old != result[i].Id {
+			unbound = append(unbound, old)
 		}
+	}
+	posted := make(map[bson.ObjectId]bool)
+	for _, s := range result {
+		posted[s.Id] = true
+	}
+	var removed []String
+	for _, id := range unbound {
+		if posted[id] || len(c.Collection.KeysOf(id)) > 0 {
+			continue
+		}
+		if s, ok := c.Collection.RemoveString(id); ok {
+			removed = append(removed, s)
+		}
+	}
 
-		// Insert new string into strings DB
-		err = S.Insert(s)
+	if len(added) > 0 || len(keys) > 0 || changed {
+		err = store.UpdateCollection(&c.Collection)
 		if err != nil {
 			return 500, rest.ServerError()
 		}
-
+	}
+	for _, s := range added {
+		publish(Event{Type: EventAdded, CollectionId: c.Collection.Id, String: s})
+	}
+	for _, s := range removed {
+		publish(Event{Type: EventDeleted, CollectionId: c.Collection.Id, String: s})
+	}
+	for i := range result {
+		c.Collection.Apply(&result[i])
 	}
 
-	if !existingString {
-		// Add String to Collection and Update Collection
-		c.Collection.Strings = append(c.Collection.Strings, s)
-		err = C.UpdateId(c.Collection.Id, c.Collection)
+	// Queue translation of the new Strings
+	if job != nil {
+		err = jobs.Enqueue(job)
 		if err != nil {
 			return 500, rest.ServerError()
 		}
 	}
 
-	return 200, &rest.APISuccess{
-		"String": s,
-		"Next": &[]rest.Rel{
-			rest.Rel{"DELETE": "/collections/" + c.Collection.Id.Hex() + "/strings/" + s.Id.Hex()},
-		},
+	var response rest.APISuccess
+	if len(result) > 1 {
+		response = rest.APISuccess{
+			"Strings": result,
+			"Next": &[]rest.Rel{
+				rest.Rel{"GET": "/collections/" + c.Collection.Id.Hex()},
+				rest.Rel{"DELETE": "/collections/" + c.Collection.Id.Hex() + "/strings/{StringId}"},
+			},
+		}
+	} else {
+		response = rest.APISuccess{
+			"String": result[0],
+			"Next": &[]rest.Rel{
+				rest.Rel{"DELETE": "/collections/" + c.Collection.Id.Hex() + "/strings/" + result[0].Id.Hex()},
+			},
+		}
+	}
+
+	if job != nil {
+		response["Job"] = job
+		next := response["Next"].(*[]rest.Rel)
+		*next = append(*next, rest.Rel{"GET": "/jobs/" + job.Id.Hex()})
 	}
+	return 200, &response
 }
 
 func (c *CollectionStrings) Put(v *url.Values) (int, rest.APIResponse) {
-	return 405, rest.InvalidMethodError(&[]rest.Rel{
-		rest.Rel{"POST": "/collections/" + c.Collection.Id.Hex() + "/strings",
-			"Params": "string",
-		},
-		rest.Rel{"DELETE": "/collections/" + c.Collection.Id.Hex() + "/strings/{StringId}"},
-	})
-}
 
-func (c *CollectionStrings) Delete(v *url.Values) (int, rest.APIResponse) {
+	// PUT on /collections/{CollectionId}/strings (without an ID) is not allowed
+	if !c.String.Id.Valid() {
+		return 405, rest.InvalidMethodError(&[]rest.Rel{
+			rest.Rel{"POST": "/collections/" + c.Collection.Id.Hex() + "/strings",
+				"Params": "string",
+			},
+			rest.Rel{"PUT": "/collections/" + c.Collection.Id.Hex() + "/strings/{StringId}",
+				"Params": "lang, translation",
+			},
+			rest.Rel{"DELETE": "/collections/" + c.Collection.Id.Hex() + "/strings/{StringId}"},
+		})
+	}
 
-	// Initialize DB
-	session, err := mgo.Dial(mongoPath)
+	// Find Collection
+	l := lockCollection(c.Collection.Id)
+	l.Lock()
+	defer l.Unlock()
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
 	if err != nil {
-		return 500, rest.ServerError()
+		return storeError(err)
+	}
+	if !c.Collection.HasString(c.String.Id) {
+		return 404, rest.NotFoundError()
 	}
-	C := session.DB(mongoDb).C("collections")
-	defer session.Close()
 
-	// Find collection
-	err = C.FindId(c.Collection.Id).One(&c.Collection)
-	if err != nil && err != mgo.ErrNotFound {
-		return 500, rest.ServerError()
+	// Validate lang and translation
+	lang := v.Get("lang")
+	if _, ok := gLangs[lang]; !ok {
+		return 422, &rest.APIError{
+			Error: rest.ErrorMsg{
+				Type:    "invalid-lang",
+				Message: "The language '" + lang + "' is not supported.",
+				Code:    422,
+				Param:   []string{"lang"},
+			},
+		}
 	}
-	if err == mgo.ErrNotFound {
-		return 404, rest.NotFoundError()
+	translation := v.Get("translation")
+	if translation == "" {
+		return 422, &rest.APIError{
+			Error: rest.ErrorMsg{
+				Type:    "invalid-translation",
+				Message: "A non-empty translation is required.",
+				Code:    422,
+				Param:   []string{"translation"},
+			},
+		}
 	}
 
-	// Loop through Strings
-	for i, String := range c.Collection.Strings {
-		if String.Id.Hex() == c.String.Id.Hex() {
-			// Remove string from collection
-			c.Collection.Strings = append(c.Collection.Strings[:i], c.Collection.Strings[i+1:]...)
+	err = store.FindString(c.String.Id, &c.String)
+	if err != nil {
+		return storeError(err)
+	}
+	if lang == sourceLang(c.String.Source) {
+		return invalidParam("lang", "The language '"+lang+"' is the source language of the string.")
+	}
+
+	// Store the reviewed translation in the Collection, other Collections keep the shared translation
+	c.Collection.SetOverride(c.String.Id, lang, translation)
+	err = store.UpdateCollection(&c.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+	c.Collection.Apply(&c.String)
+	publish(Event{Type: EventEdited, CollectionId: c.Collection.Id, String: c.String, Languages: []string{lang}})
+
+	path := "/collections/" + c.Collection.Id.Hex() + "/strings/" + c.String.Id.Hex()
+	return 200, &rest.APISuccess{
+		"String": c.String,
+		"Next": &[]rest.Rel{
+			rest.Rel{"GET": path},
+			rest.Rel{"DELETE": path},
+		},
+	}
+}
+
+func (c *CollectionStrings) Delete(v *url.Values) (int, rest.APIResponse) {
+
+	// Find collection
+	l := lockCollection(c.Collection.Id)
+	l.Lock()
+	defer l.Unlock()
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+
+	// Remove the Override of a language only, the String falls back to the shared translation
+	if lang := v.Get("lang"); lang != "" {
+		if !c.Collection.RemoveOverride(c.String.Id, lang) {
+			return 404, rest.NotFoundError()
+		}
+		err = store.UpdateCollection(&c.Collection)
+		if err != nil {
+			return storeError(err)
+		}
+		err = store.FindString(c.String.Id, &c.String)
+		if err != nil {
+			return storeError(err)
+		}
+		c.Collection.Apply(&c.String)
+		publish(Event{Type: EventEdited, CollectionId: c.Collection.Id, String: c.String, Languages: []string{lang}})
+		return 200, &rest.APISuccess{
+			"String": c.String,
+			"Next": &[]rest.Rel{
+				rest.Rel{"GET": "/collections/" + c.Collection.Id.Hex() + "/strings/" + c.String.Id.Hex()},
+			},
 		}
 	}
 
+	// Remove string from collection, with its keys and overrides
+	removed, ok := c.Collection.RemoveString(c.String.Id)
+
 	// Update Collection
-	err = C.UpdateId(c.Collection.Id, c.Collection)
+	err = store.UpdateCollection(&c.Collection)
 	if err != nil {
 		return 500, rest.ServerError()
 	}
+	if ok {
+		publish(Event{Type: EventDeleted, CollectionId: c.Collection.Id, String: removed})
+	}
 
 	return 200, &rest.APISuccess{
 		"Success": true,
@@ -5,12 +5,51 @@ package main
 import (
 	"encoding/json"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 	"translation.io/rest"
 )
 
+// testTranslator prefixes text with the target language
+type testTranslator struct{}
+
+func (t testTranslator) Name() string {
+	return "test"
+}
+
+func (t testTranslator) Translate(text string, source string, target string) (string, error) {
+	return "[" + target + "] " + text, nil
+}
+
+func (t testTranslator) Languages() []string {
+	return []string{"de", "fr", "nl"}
+}
+
+// runJobs runs all queued Jobs once, as tests don't start any workers
+func runJobs(t *testing.T) {
+	queued, err := store.FindJobs([]string{JobQueued})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range queued {
+		if err := jobs.Run(j.Id); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
 func TestCollections(t *testing.T) {
 
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator, _ = ParseRoutes("nl=failing;*=test", map[string]Translator{
+		"test":    testTranslator{},
+		"failing": failingTranslator{},
+	})
+
 	type Single struct {
 		Collection Collection
 	}
@@ -80,6 +119,40 @@ func TestCollections(t *testing.T) {
 		t.Log(res.ToJSON())
 	}
 
+	var ps struct {
+		String String
+		Job    Job
+	}
+	err = json.Unmarshal([]byte(res.ToJSON()), &ps)
+	if err != nil {
+		t.Error(err)
+	}
+	if ps.String.Status["de"].State != StatusPending || ps.Job.State != JobQueued {
+		t.Errorf("String should be pending: %v", ps)
+	}
+
+	t.Log("Translate string in the background")
+	runJobs(t)
+	s := String{}
+	err = store.FindString(ps.String.Id, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Translations["de"] != "[de] "+str {
+		t.Errorf("String was not translated: %v", s.Translations)
+	}
+	if s.Status["de"].State != StatusMachine {
+		t.Errorf("Unexpected status: %v", s.Status["de"])
+	}
+	if s.Status["nl"].State != StatusFailed || s.Status["nl"].Reason == "" {
+		t.Errorf("Unexpected status: %v", s.Status["nl"])
+	}
+	j := Job{}
+	store.FindJob(ps.Job.Id, &j)
+	if j.State != JobQueued || j.Attempts != 1 || len(j.Failures) != 1 {
+		t.Errorf("Job should be queued for a retry: %v", j)
+	}
+
 	t.Log("DELETE string from Collection")
 	c1 := len(cs.Collection.Strings)
 	cs.String.Id = cs.Collection.Strings[0].Id
@@ -98,3 +171,863 @@ func TestCollections(t *testing.T) {
 	// }
 
 }
+
+// batchTranslator counts the requests it receives
+type batchTranslator struct {
+	testTranslator
+	mu       sync.Mutex
+	requests int
+}
+
+func (b *batchTranslator) TranslateBatch(texts []string, source string, target string) ([]string, error) {
+	b.mu.Lock()
+	b.requests++
+	b.mu.Unlock()
+	translations := make([]string, len(texts))
+	for i, text := range texts {
+		translations[i], _ = b.Translate(text, source, target)
+	}
+	return translations, nil
+}
+
+func TestBulkStrings(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	bt := &batchTranslator{}
+	translator = bt
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Bulk")
+	c.Post(v)
+
+	t.Log("POST several strings to Collection")
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	for i := 0; i < 120; i++ {
+		v.Add("string", "String "+strconv.Itoa(i))
+	}
+	v.Add("string", "String 0")
+
+	status, res := cs.Post(v)
+	if status != 200 {
+		t.Fatalf("Could not POST to CollectionStrings, status: %d", status)
+	}
+
+	var p struct {
+		Strings []String
+	}
+	err := json.Unmarshal([]byte(res.ToJSON()), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Strings) != 121 || p.Strings[120].Id != p.Strings[0].Id {
+		t.Errorf("Unexpected Strings in response: %d", len(p.Strings))
+	}
+	runJobs(t)
+	s := String{}
+	store.FindString(p.Strings[119].Id, &s)
+	if s.Translations["nl"] != "[nl] String 119" {
+		t.Errorf("String was not translated: %v", s.Translations)
+	}
+	if len(cs.Collection.Strings) != 120 {
+		t.Errorf("Expected 120 Strings in Collection, got: %d", len(cs.Collection.Strings))
+	}
+
+	// 3 languages with 3 batches of at most 50 strings
+	if bt.requests != 9 {
+		t.Errorf("Expected 9 requests, got: %d", bt.requests)
+	}
+}
+
+// contextTranslator appends the context to its translations
+type contextTranslator struct {
+	batchTranslator
+}
+
+func (c *contextTranslator) TranslateContext(texts []string, context string, source string, target string) ([]string, error) {
+	translations, err := c.TranslateBatch(texts, source, target)
+	for i := range translations {
+		translations[i] += " (" + context + ")"
+	}
+	return translations, err
+}
+
+func TestStringContext(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = &contextTranslator{}
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Context")
+	c.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+
+	t.Log("Invalid context")
+	tests := []struct{ query, param string }{
+		{"string=Open&string=Close&description=Verb", "description"},
+		{"string=Open&screenshot=ftp://localhost/open.png", "screenshot"},
+		{"string=Open&maxlength=0", "maxlength"},
+		{"string=Open&maxlength=ten", "maxlength"},
+	}
+	for _, test := range tests {
+		v, _ := url.ParseQuery(test.query)
+		status, res := cs.Post(&v)
+		if status != 422 || !strings.Contains(res.ToJSON(), "invalid-"+test.param) {
+			t.Errorf("Expected invalid-%s for '%s', got: %d %s", test.param, test.query, status, res.ToJSON())
+		}
+	}
+
+	t.Log("POST the same text with and without a description")
+	v = &url.Values{
+		"string":      {"Open", "Open"},
+		"description": {"Button that opens a file", ""},
+		"screenshot":  {"https://example.com/open.png", ""},
+		"maxlength":   {"12", ""},
+	}
+	status, res := cs.Post(v)
+	if status != 200 {
+		t.Fatalf("Could not POST Strings, status: %d, %s", status, res.ToJSON())
+	}
+	var p struct {
+		Strings []String
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if len(p.Strings) != 2 || p.Strings[0].Id == p.Strings[1].Id {
+		t.Fatalf("Expected two different Strings, got: %v", p.Strings)
+	}
+	if s := p.Strings[0]; s.Description != "Button that opens a file" || s.Screenshot != "https://example.com/open.png" || s.MaxLength != 12 {
+		t.Errorf("Context was not saved: %v", s)
+	}
+
+	t.Log("Descriptions are sent to the translator")
+	runJobs(t)
+	var s String
+	store.FindString(p.Strings[0].Id, &s)
+	if s.Translations["de"] != "[de] Open (Button that opens a file)" {
+		t.Errorf("Unexpected translation with context: %v", s.Translations)
+	}
+	store.FindString(p.Strings[1].Id, &s)
+	if s.Translations["de"] != "[de] Open" {
+		t.Errorf("Unexpected translation without context: %v", s.Translations)
+	}
+
+	t.Log("A new maxlength updates the String in this Collection only")
+	v = &url.Values{"string": {"Open"}, "maxlength": {"8"}}
+	if status, _ = cs.Post(v); status != 200 {
+		t.Fatalf("Could not POST String, status: %d", status)
+	}
+	other := &Collection{}
+	other.Post(&url.Values{"name": {"Other"}})
+	ocs := &CollectionStrings{}
+	ocs.Collection.Id = other.Id
+	ocs.Post(&url.Values{"string": {"Open"}, "screenshot": {"https://other.example.com/open.png"}, "maxlength": {"4"}})
+	var ps struct {
+		String String
+	}
+	_, res = Router("/collections/" + c.Id.Hex() + "/strings/" + p.Strings[1].Id.Hex()).Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &ps)
+	if ps.String.MaxLength != 8 || ps.String.Screenshot != "" || ps.String.Translations["de"] != "[de] Open" {
+		t.Errorf("String was not updated in this Collection only: %v", ps.String)
+	}
+	_, res = Router("/collections/" + other.Id.Hex() + "/strings/" + p.Strings[1].Id.Hex()).Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &ps)
+	if ps.String.MaxLength != 4 || ps.String.Screenshot != "https://other.example.com/open.png" {
+		t.Errorf("String of the other Collection: %v", ps.String)
+	}
+}
+
+func TestRetranslate(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = failingTranslator{}
+	translators["test"] = testTranslator{}
+	defer delete(translators, "test")
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Retranslate")
+	c.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	v.Set("string", "Try again")
+	cs.Post(v)
+	id := cs.Collection.Strings[0].Id
+	runJobs(t)
+
+	t.Log("POST retranslate with an unknown provider")
+	r, ok := Router("/collections/" + c.Id.Hex() + "/strings/" + id.Hex() + "/retranslate").(*Retranslation)
+	if !ok {
+		t.Fatal("Router did not return a Retranslation")
+	}
+	v = &url.Values{}
+	v.Set("provider", "unknown")
+	if status, _ := r.Post(v); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("POST retranslate for some languages")
+	v = &url.Values{}
+	v.Set("provider", "test")
+	v.Set("lang", "de,nl")
+	status, res := r.Post(v)
+	if status != 200 {
+		t.Fatalf("Could not POST retranslate, status: %d", status)
+	}
+
+	var p struct {
+		String String
+	}
+	err := json.Unmarshal([]byte(res.ToJSON()), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String.Status["nl"].State != StatusPending {
+		t.Errorf("String should be pending: %v", p.String)
+	}
+
+	runJobs(t)
+	s := String{}
+	store.FindString(id, &s)
+	if s.Status["nl"].State != StatusMachine || s.Translations["nl"] != "[nl] Try again" {
+		t.Errorf("String was not retranslated: %v", s)
+	}
+	if s.Status["fr"].State != StatusFailed {
+		t.Errorf("Language was retranslated without being asked: %v", s.Status["fr"])
+	}
+
+	t.Log("GET Collection with retranslated String")
+	c.Get(&url.Values{})
+	if c.Strings[0].Translations["de"] != "[de] Try again" {
+		t.Errorf("Collection has a stale String: %v", c.Strings[0])
+	}
+
+	t.Log("POST retranslate with an invalid force")
+	rc := Router("/collections/" + c.Id.Hex() + "/retranslate")
+	if status, _ := rc.Post(&url.Values{"force": {"yes"}}); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("Languages that are done are only retranslated when forced or given explicitly")
+	var pj struct {
+		Job *Job
+	}
+	v = &url.Values{"provider": {"test"}, "lang": {"de"}, "force": {"false"}}
+	_, res = rc.Post(v)
+	json.Unmarshal([]byte(res.ToJSON()), &pj)
+	if pj.Job != nil {
+		t.Errorf("Expected no Job for a language that is done: %v", pj.Job)
+	}
+	v.Del("force")
+	_, res = rc.Post(v)
+	json.Unmarshal([]byte(res.ToJSON()), &pj)
+	if pj.Job == nil || len(pj.Job.StringIds) != 1 {
+		t.Fatalf("Expected a Job for an explicit language: %v", pj.Job)
+	}
+	forced := pj.Job.Id
+	runJobs(t)
+
+	t.Log("Jobs report their own progress")
+	rc.Post(&url.Values{"lang": {"de"}, "force": {"true"}})
+	runJobs(t)
+	j := Router("/jobs/" + forced.Hex()).(*Job)
+	j.Get(&url.Values{})
+	if len(j.Progress.Done) != 1 || j.Translated["de"] != 1 {
+		t.Errorf("Progress of another Job was reported: %v", j)
+	}
+}
+
+func TestJobs(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	jobs.MaxAttempts = 1
+	translator = failingTranslator{}
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Jobs")
+	c.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	v.Set("string", "Keep trying")
+	_, res := cs.Post(v)
+	var ps struct {
+		Job Job
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &ps)
+
+	t.Log("GET pending Job")
+	j, ok := Router("/jobs/" + ps.Job.Id.Hex()).(*Job)
+	if !ok {
+		t.Fatal("Router did not return a Job")
+	}
+	status, _ := j.Get(&url.Values{})
+	if status != 200 || j.Progress == nil || len(j.Progress.Pending) != 3 {
+		t.Fatalf("Unexpected Job, status: %d, %v", status, j)
+	}
+
+	t.Log("POST retry on a Job that did not fail")
+	r := Router("/jobs/" + ps.Job.Id.Hex() + "/retry")
+	if status, _ := r.Post(&url.Values{}); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("GET failed Job")
+	runJobs(t)
+	j.Get(&url.Values{})
+	if j.State != JobFailed || len(j.Progress.Failed) != 3 || len(j.Failures) != 3 {
+		t.Errorf("Job should have failed: %v", j)
+	}
+
+	t.Log("POST retry on a failed Job")
+	translator = testTranslator{}
+	if status, _ := r.Post(&url.Values{}); status != 200 {
+		t.Fatalf("Could not retry Job, status: %d", status)
+	}
+	runJobs(t)
+
+	t.Log("GET Jobs of Collection")
+	status, res = Router("/collections/" + c.Id.Hex() + "/jobs").Get(&url.Values{})
+	var pj struct {
+		Jobs []Job
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &pj)
+	if status != 200 || len(pj.Jobs) != 1 {
+		t.Fatalf("Unexpected Jobs, status: %d, %v", status, pj)
+	}
+	if pj.Jobs[0].State != JobDone || len(pj.Jobs[0].Progress.Done) != 3 {
+		t.Errorf("Job should be done: %v", pj.Jobs[0])
+	}
+}
+
+// listStrings GETs a page of Strings and returns the query of the next and previous page
+func listStrings(t *testing.T, cs *CollectionStrings, query string) ([]string, url.Values, url.Values) {
+	v, _ := url.ParseQuery(query)
+	status, res := cs.Get(&v)
+	if status != 200 {
+		t.Fatalf("Could not GET Strings, status: %d", status)
+	}
+	var p struct {
+		Strings []String
+		Next    []rest.Rel
+		Prev    []rest.Rel
+	}
+	if err := json.Unmarshal([]byte(res.ToJSON()), &p); err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, s := range p.Strings {
+		texts = append(texts, s.String)
+	}
+	var next, prev url.Values
+	if u, err := url.Parse(p.Next[0]["GET"]); err == nil && u.RawQuery != "" {
+		next = u.Query()
+	}
+	if len(p.Prev) > 0 {
+		u, _ := url.Parse(p.Prev[0]["GET"])
+		prev = u.Query()
+	}
+	return texts, next, prev
+}
+
+func TestListStrings(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = testTranslator{}
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "List")
+	c.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	for _, str := range []string{"e", "d", "c", "b", "a"} {
+		v = &url.Values{}
+		v.Set("string", str)
+		cs.Post(v)
+	}
+
+	t.Log("GET Strings by creation time")
+	texts, next, prev := listStrings(t, cs, "limit=2")
+	if strings.Join(texts, "") != "ed" || next == nil || prev != nil {
+		t.Errorf("Unexpected first page: %v", texts)
+	}
+	texts, next, _ = listStrings(t, cs, next.Encode())
+	if strings.Join(texts, "") != "cb" || next == nil {
+		t.Errorf("Unexpected second page: %v", texts)
+	}
+	texts, next, prev = listStrings(t, cs, next.Encode())
+	if strings.Join(texts, "") != "a" || next != nil || prev == nil {
+		t.Errorf("Unexpected last page: %v", texts)
+	}
+	texts, _, _ = listStrings(t, cs, prev.Encode())
+	if strings.Join(texts, "") != "cb" {
+		t.Errorf("Unexpected previous page: %v", texts)
+	}
+
+	t.Log("GET Strings by text")
+	texts, next, _ = listStrings(t, cs, "sort=text&limit=3")
+	if strings.Join(texts, "") != "abc" {
+		t.Errorf("Unexpected first page: %v", texts)
+	}
+	texts, _, _ = listStrings(t, cs, next.Encode())
+	if strings.Join(texts, "") != "de" {
+		t.Errorf("Unexpected second page: %v", texts)
+	}
+
+	t.Log("GET Strings with an invalid limit")
+	v = &url.Values{}
+	v.Set("limit", "1000")
+	if status, _ := cs.Get(v); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+}
+
+func TestGetString(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = testTranslator{}
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Get")
+	c.Post(v)
+	other := &Collection{}
+	other.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	v.Set("string", "Find me")
+	cs.Post(v)
+	id := cs.Collection.Strings[0].Id
+	runJobs(t)
+
+	t.Log("GET String")
+	status, res := Router("/collections/" + c.Id.Hex() + "/strings/" + id.Hex()).Get(&url.Values{})
+	if status != 200 {
+		t.Fatalf("Could not GET String, status: %d", status)
+	}
+	var p struct {
+		String String
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if p.String.Translations["fr"] != "[fr] Find me" || p.String.Status["fr"].State != StatusMachine {
+		t.Errorf("Unexpected String: %v", p.String)
+	}
+
+	t.Log("GET String of another Collection")
+	status, _ = Router("/collections/" + other.Id.Hex() + "/strings/" + id.Hex()).Get(&url.Values{})
+	if status != 404 {
+		t.Errorf("Expected status 404, got: %d", status)
+	}
+}
+
+func TestReviewString(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = testTranslator{}
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Review")
+	c.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	v.Set("string", "Good morning")
+	v.Set("key", "greeting")
+	cs.Post(v)
+	id := cs.Collection.Strings[0].Id
+	runJobs(t)
+
+	t.Log("PUT translation with an unsupported language")
+	r := Router("/collections/" + c.Id.Hex() + "/strings/" + id.Hex())
+	v = &url.Values{}
+	v.Set("lang", "xx")
+	v.Set("translation", "Goedemorgen")
+	if status, _ := r.Put(v); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("PUT reviewed translation")
+	v.Set("lang", "nl")
+	if status, res := r.Put(v); status != 200 {
+		t.Fatalf("Could not PUT translation, status: %d, %s", status, res.ToJSON())
+	}
+
+	t.Log("Retranslate keeps the reviewed translation")
+	rt := Router("/collections/" + c.Id.Hex() + "/retranslate")
+	if status, _ := rt.Post(&url.Values{"force": {"true"}}); status != 200 {
+		t.Fatalf("Could not POST retranslate, status: %d", status)
+	}
+	runJobs(t)
+	var p struct {
+		String String
+	}
+	_, res := r.Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if p.String.Translations["nl"] != "Goedemorgen" || p.String.Status["nl"].State != StatusReviewed {
+		t.Errorf("Reviewed translation was overwritten: %v", p.String)
+	}
+
+	t.Log("PUT Collection keeps the overrides and keys")
+	v = &url.Values{}
+	v.Set("name", "Reviewed")
+	if status, _ := Router("/collections/" + c.Id.Hex()).Put(v); status != 200 {
+		t.Fatalf("Could not PUT Collection, status: %d", status)
+	}
+	_, res = r.Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if p.String.Translations["nl"] != "Goedemorgen" || len(p.String.Keys) != 1 {
+		t.Errorf("PUT Collection dropped the overrides or keys: %v", p.String)
+	}
+
+	t.Log("Concurrent PUTs of translations keep every override")
+	var wg sync.WaitGroup
+	for _, lang := range []string{"de", "fr", "es", "it", "pt"} {
+		wg.Add(1)
+		go func(lang string) {
+			defer wg.Done()
+			Router("/collections/" + c.Id.Hex() + "/strings/" + id.Hex()).Put(&url.Values{"lang": {lang}, "translation": {lang}})
+		}(lang)
+	}
+	wg.Wait()
+	_, res = r.Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	for _, lang := range []string{"nl", "de", "fr", "es", "it", "pt"} {
+		if p.String.Status[lang].State != StatusReviewed {
+			t.Errorf("Override of %s was lost: %v", lang, p.String)
+		}
+	}
+
+	t.Log("Other Collections keep the shared translation")
+	other := &Collection{}
+	v = &url.Values{}
+	v.Set("name", "Other")
+	other.Post(v)
+	ocs := &CollectionStrings{}
+	ocs.Collection.Id = other.Id
+	v = &url.Values{}
+	v.Set("string", "Good morning")
+	ocs.Post(v)
+	_, res = Router("/collections/" + other.Id.Hex() + "/strings/" + id.Hex()).Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if p.String.Translations["nl"] != "[nl] Good morning" {
+		t.Errorf("Override leaked into another Collection: %v", p.String)
+	}
+
+	t.Log("DELETE the override")
+	v = &url.Values{}
+	v.Set("lang", "nl")
+	if status, _ := r.Delete(v); status != 200 {
+		t.Fatalf("Could not DELETE override, status: %d", status)
+	}
+	_, res = r.Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if p.String.Translations["nl"] != "[nl] Good morning" || p.String.Status["nl"].State != StatusMachine {
+		t.Errorf("String did not fall back to the shared translation: %v", p.String)
+	}
+}
+
+func TestListCollections(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = testTranslator{}
+
+	for _, name := range []string{"Website", "App", "Web shop"} {
+		c := &Collection{}
+		v := &url.Values{}
+		v.Set("name", name)
+		c.Post(v)
+		if name == "App" {
+			cs := &CollectionStrings{}
+			cs.Collection.Id = c.Id
+			v = &url.Values{}
+			v.Add("string", "One")
+			v.Add("string", "Two")
+			cs.Post(v)
+		}
+	}
+
+	type List struct {
+		Collections []CollectionSummary
+		Next        []rest.Rel
+	}
+
+	t.Log("GET Collections")
+	v := &url.Values{}
+	v.Set("limit", "2")
+	status, res := Router("/collections").Get(v)
+	var p List
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if status != 200 || len(p.Collections) != 2 || p.Collections[1].StringCount != 2 {
+		t.Fatalf("Unexpected Collections, status: %d, %v", status, p)
+	}
+
+	t.Log("GET next page of Collections")
+	u, _ := url.Parse(p.Next[0]["GET"])
+	q := u.Query()
+	_, res = Router("/collections").Get(&q)
+	p = List{}
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if len(p.Collections) != 1 || p.Collections[0].Name != "Web shop" || p.Collections[0].Modified.IsZero() {
+		t.Errorf("Unexpected next page: %v", p)
+	}
+
+	t.Log("GET Collections by name")
+	v = &url.Values{}
+	v.Set("name", "web")
+	_, res = Router("/collections").Get(v)
+	p = List{}
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if len(p.Collections) != 2 {
+		t.Errorf("Unexpected Collections by name: %v", p)
+	}
+
+	t.Log("GET Collections with an invalid after")
+	if status, res := Router("/collections").Get(&url.Values{"after": {"nope"}}); status != 422 || !strings.Contains(res.ToJSON(), "invalid-after") {
+		t.Errorf("Expected an invalid after, got: %d, %s", status, res.ToJSON())
+	}
+
+	t.Log("Translations and overrides update the Modified time")
+	modified := func(name string) time.Time {
+		_, res := Router("/collections").Get(&url.Values{"name": {name}})
+		var p List
+		json.Unmarshal([]byte(res.ToJSON()), &p)
+		return p.Collections[0].Modified
+	}
+	before := modified("App")
+	runJobs(t)
+	translated := modified("App")
+	if !translated.After(before) {
+		t.Errorf("Modified was not updated by translations: %v, %v", before, translated)
+	}
+	_, res = Router("/collections").Get(&url.Values{"name": {"App"}})
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	var app Collection
+	store.FindCollection(p.Collections[0].Id, &app)
+	path := "/collections/" + app.Id.Hex() + "/strings/" + app.Strings[0].Id.Hex()
+	Router(path).Put(&url.Values{"lang": {"nl"}, "translation": {"Een"}})
+	if reviewed := modified("App"); !reviewed.After(translated) {
+		t.Errorf("Modified was not updated by an override: %v, %v", translated, reviewed)
+	}
+}
+
+// sourceTranslator prefixes text with the source and target language
+type sourceTranslator struct {
+	testTranslator
+}
+
+func (s sourceTranslator) Translate(text string, source string, target string) (string, error) {
+	return "[" + source + ">" + target + "] " + text, nil
+}
+
+func (s sourceTranslator) Languages() []string {
+	return []string{"de", "en", "ja"}
+}
+
+func TestSourceLanguage(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = sourceTranslator{}
+
+	t.Log("POST Collection with an unsupported source language")
+	c := &Collection{}
+	v := &url.Values{"name": {"Japanese"}, "source": {"xx"}}
+	if status, _ := c.Post(v); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("POST Collection in Japanese")
+	v.Set("source", "ja")
+	if status, _ := c.Post(v); status != 200 || c.Source != "ja" {
+		t.Fatalf("Could not POST Collection, status: %d, %v", status, c)
+	}
+	english := &Collection{}
+	english.Post(&url.Values{"name": {"English"}})
+	if english.Source != "en" {
+		t.Errorf("Expected English by default, got: '%s'", english.Source)
+	}
+
+	t.Log("Strings are translated from the source language into the other languages")
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	_, res := cs.Post(&url.Values{"string": {"開く"}})
+	var p struct {
+		String String
+		Job    Job
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if p.String.Source != "ja" || p.Job.Source != "ja" || strings.Join(p.Job.Languages, ",") != "de,en" {
+		t.Errorf("Unexpected String or Job: %v, %v", p.String, p.Job)
+	}
+	runJobs(t)
+	var s String
+	store.FindString(p.String.Id, &s)
+	if s.Translations["en"] != "[ja>en] 開く" || s.Translations["ja"] != "" {
+		t.Errorf("Unexpected translations: %v", s.Translations)
+	}
+
+	t.Log("The same text in English is another String")
+	ecs := &CollectionStrings{}
+	ecs.Collection.Id = english.Id
+	var e struct {
+		String String
+	}
+	_, res = ecs.Post(&url.Values{"string": {"開く"}})
+	json.Unmarshal([]byte(res.ToJSON()), &e)
+	if e.String.Id == p.String.Id {
+		t.Errorf("Expected another String for another source language")
+	}
+
+	t.Log("PUT a translation into the source language")
+	r := Router("/collections/" + c.Id.Hex() + "/strings/" + p.String.Id.Hex())
+	if status, _ := r.Put(&url.Values{"lang": {"ja"}, "translation": {"開ける"}}); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("The source language can't change once there are Strings")
+	rc := Router("/collections/" + c.Id.Hex())
+	if status, _ := rc.Put(&url.Values{"name": {"Japanese"}, "source": {"de"}}); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+	var pc struct {
+		Collection Collection
+	}
+	status, res := rc.Put(&url.Values{"name": {"日本語"}})
+	json.Unmarshal([]byte(res.ToJSON()), &pc)
+	if status != 200 || pc.Collection.Source != "ja" || len(pc.Collection.Strings) != 1 {
+		t.Errorf("Unexpected Collection after PUT: %d, %v", status, pc.Collection)
+	}
+}
+
+// detectTranslator detects Japanese, Latin and English texts
+type detectTranslator struct {
+	sourceTranslator
+}
+
+func (d detectTranslator) Detect(texts []string) ([]Detection, error) {
+	detections := make([]Detection, len(texts))
+	for i, text := range texts {
+		switch {
+		case text == "Lorem ipsum":
+			detections[i] = Detection{Language: "la", Confidence: 0.5}
+		case len(text) > len([]rune(text)):
+			detections[i] = Detection{Language: "ja", Confidence: 0.9}
+		default:
+			detections[i] = Detection{Language: "en", Confidence: 0.8}
+		}
+	}
+	return detections, nil
+}
+
+func TestDetectSourceLanguage(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = sourceTranslator{}
+
+	t.Log("Providers that can't detect languages")
+	c := &Collection{}
+	status, res := c.Post(&url.Values{"name": {"Mixed"}, "source": {"auto"}})
+	if status != 422 || !strings.Contains(res.ToJSON(), "invalid-source") {
+		t.Errorf("Expected invalid-source, got: %d %s", status, res.ToJSON())
+	}
+	other := &Collection{}
+	other.Post(&url.Values{"name": {"Other"}})
+	status, res = Router("/collections/" + other.Id.Hex()).Put(&url.Values{"name": {"Other"}, "source": {"auto"}})
+	if status != 422 || !strings.Contains(res.ToJSON(), "invalid-source") {
+		t.Errorf("Expected invalid-source on PUT, got: %d %s", status, res.ToJSON())
+	}
+	routed, _ := ParseRoutes("*=test", map[string]Translator{"test": testTranslator{}})
+	detecting, _ := ParseRoutes("ja=detect;*=test", map[string]Translator{"test": testTranslator{}, "detect": detectTranslator{}})
+	if canDetect(routed) || !canDetect(detecting) {
+		t.Errorf("Routes should detect languages when one of their providers does")
+	}
+	translator = routed
+	if status, _ = c.Post(&url.Values{"name": {"Mixed"}, "source": {"auto"}}); status != 422 {
+		t.Errorf("Expected status 422 for routes without a detector, got: %d", status)
+	}
+
+	translator = detectTranslator{}
+	c.Post(&url.Values{"name": {"Mixed"}, "source": {"auto"}})
+	if c.Source != "auto" {
+		t.Fatalf("Expected an automatic source language, got: '%s'", c.Source)
+	}
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+
+	t.Log("Strings of a Collection whose translator can no longer detect languages")
+	translator = routed
+	status, res = cs.Post(&url.Values{"string": {"Open"}})
+	if status != 422 || !strings.Contains(res.ToJSON(), "invalid-source") {
+		t.Errorf("Expected invalid-source, got: %d %s", status, res.ToJSON())
+	}
+	translator = detectTranslator{}
+
+	t.Log("Detected languages that are not supported")
+	status, res = cs.Post(&url.Values{"string": {"Open", "Lorem ipsum"}})
+	if status != 422 || !strings.Contains(res.ToJSON(), "invalid-string") {
+		t.Errorf("Expected invalid-string, got: %d %s", status, res.ToJSON())
+	}
+
+	t.Log("Strings are translated from their detected language")
+	status, res = cs.Post(&url.Values{"string": {"Open", "開く"}})
+	if status != 200 {
+		t.Fatalf("Could not POST Strings, status: %d, %s", status, res.ToJSON())
+	}
+	var p struct {
+		Strings []String
+		Job     Job
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &p)
+	if p.Strings[0].Source != "en" || p.Strings[0].Confidence != 0.8 || p.Strings[1].Source != "ja" || p.Strings[1].Confidence != 0.9 {
+		t.Errorf("Unexpected detections: %v", p.Strings)
+	}
+	if p.Job.Source != "auto" || strings.Join(p.Job.Languages, ",") != "de,en,ja" {
+		t.Errorf("Unexpected Job: %v", p.Job)
+	}
+	runJobs(t)
+	var s String
+	store.FindString(p.Strings[0].Id, &s)
+	if s.Translations["ja"] != "[en>ja] Open" || s.Translations["de"] != "[en>de] Open" || s.Translations["en"] != "" {
+		t.Errorf("Unexpected translations from English: %v", s.Translations)
+	}
+	store.FindString(p.Strings[1].Id, &s)
+	if s.Translations["en"] != "[ja>en] 開く" || s.Translations["ja"] != "" {
+		t.Errorf("Unexpected translations from Japanese: %v", s.Translations)
+	}
+	if _, ok := s.Status["ja"]; ok {
+		t.Errorf("The source language has a status: %v", s.Status)
+	}
+
+	t.Log("The Job is done in all languages")
+	var pj struct {
+		Job Job
+	}
+	_, res = Router("/jobs/" + p.Job.Id.Hex()).Get(&url.Values{})
+	json.Unmarshal([]byte(res.ToJSON()), &pj)
+	if pj.Job.State != JobDone || len(pj.Job.Progress.Done) != 3 {
+		t.Errorf("Unexpected Job: %v", pj.Job)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"labix.org/v2/mgo/bson"
+	"net/url"
+	"strings"
+	"translation.io/rest"
+)
+
+// Retranslation queues machine translation again for a single String, or for all Strings of a Collection
+type Retranslation struct {
+	Collection Collection
+	String     String
+}
+
+// Implements APIResponse interface
+func (r *Retranslation) ToJSON() string {
+	return rest.ParseAPIResponse(r)
+}
+
+// listParam returns all values of a param, given either repeated or separated by commas
+func listParam(v *url.Values, name string) []string {
+	var list []string
+	for _, value := range (*v)[name] {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// allowed returns the methods that are allowed on a Retranslation
+func (r *Retranslation) allowed() *[]rest.Rel {
+	path := "/collections/" + r.Collection.Id.Hex()
+	if r.String.Id.Valid() {
+		path += "/strings/" + r.String.Id.Hex()
+	}
+	return &[]rest.Rel{
+		rest.Rel{"POST": path + "/retranslate",
+			"Params": "lang, provider, force",
+		},
+	}
+}
+
+func (r *Retranslation) Get(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(r.allowed())
+}
+
+func (r *Retranslation) Post(v *url.Values) (int, rest.APIResponse) {
+
+	// Find Collection, its Strings can't change while they are marked as pending
+	cl := lockCollection(r.Collection.Id)
+	cl.Lock()
+	defer cl.Unlock()
+	err := store.FindCollection(r.Collection.Id, &r.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+
+	// Validate provider
+	t := translator
+	if name := v.Get("provider"); name != "" {
+		var ok bool
+		t, ok = translators[name]
+		if !ok {
+			return 422, &rest.APIError{
+				Error: rest.ErrorMsg{
+					Type:    "invalid-provider",
+					Message: "The provider '" + name + "' is not configured.",
+					Code:    422,
+					Param:   []string{"provider"},
+				},
+			}
+		}
+	}
+
+	// Validate languages, all languages of the provider are retranslated by default
+	source := sourceLang(r.Collection.Source)
+	langs := listParam(v, "lang")
+	for _, lang := range langs {
+		if _, ok := gLangs[lang]; !ok {
+			return 422, &rest.APIError{
+				Error: rest.ErrorMsg{
+					Type:    "invalid-lang",
+					Message: "The language '" + lang + "' is not supported.",
+					Code:    422,
+					Param:   []string{"lang"},
+				},
+			}
+		}
+		if lang == source {
+			return invalidParam("lang", "The language '"+lang+"' is the source language of the Collection.")
+		}
+	}
+	explicit := len(langs) > 0
+	if !explicit {
+		langs = targetLangs(t, source)
+	}
+
+	// Languages that are done are only translated again when forced or when they're given explicitly
+	force := v.Get("force")
+	if force != "" && force != "true" && force != "false" {
+		return invalidParam("force", "Force should be true or false.")
+	}
+	if explicit && force == "" {
+		force = "true"
+	}
+
+	// Retranslate a single String or all Strings of the Collection
+	var ids []bson.ObjectId
+	if r.String.Id.Valid() {
+		if !r.Collection.HasString(r.String.Id) {
+			return 404, rest.NotFoundError()
+		}
+		ids = []bson.ObjectId{r.String.Id}
+	} else {
+		for _, s := range r.Collection.Strings {
+			ids = append(ids, s.Id)
+		}
+	}
+
+	// Mark the languages as pending
+	job := &Job{
+		CollectionId: r.Collection.Id,
+		Source:       source,
+		Languages:    langs,
+		Provider:     v.Get("provider"),
+	}
+	var strs []String
+	for _, id := range ids {
+		var s String
+		l := lockString(id)
+		l.Lock()
+		var todo []string
+		err = store.FindString(id, &s)
+		if err == nil {
+			for _, lang := range without(langs, sourceLang(s.Source)) {
+				if force == "true" || s.Status[lang].State != StatusMachine {
+					todo = append(todo, lang)
+				}
+			}
+			if len(todo) > 0 {
+				s.SetPending(todo)
+				err = store.UpdateString(&s)
+			}
+		}
+		l.Unlock()
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 500, rest.ServerError()
+		}
+		if len(todo) > 0 {
+			job.StringIds = append(job.StringIds, s.Id)
+		}
+		r.Collection.Apply(&s)
+		strs = append(strs, s)
+	}
+
+	// Queue translation of the Strings that are not done
+	if len(job.StringIds) > 0 {
+		err = jobs.Enqueue(job)
+		if err != nil {
+			return 500, rest.ServerError()
+		}
+	}
+
+	var response rest.APISuccess
+	if r.String.Id.Valid() && len(strs) == 1 {
+		response = rest.APISuccess{
+			"String": strs[0],
+			"Next": &[]rest.Rel{
+				rest.Rel{"DELETE": "/collections/" + r.Collection.Id.Hex() + "/strings/" + strs[0].Id.Hex()},
+			},
+		}
+	} else {
+		response = rest.APISuccess{
+			"Strings": strs,
+			"Next": &[]rest.Rel{
+				rest.Rel{"GET": "/collections/" + r.Collection.Id.Hex()},
+			},
+		}
+	}
+
+	if len(job.StringIds) > 0 {
+		response["Job"] = job
+		next := response["Next"].(*[]rest.Rel)
+		*next = append(*next, rest.Rel{"GET": "/jobs/" + job.Id.Hex()})
+	}
+	return 200, &response
+}
+
+func (r *Retranslation) Put(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(r.allowed())
+}
+
+func (r *Retranslation) Delete(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(r.allowed())
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RoutedTranslator sends every target language to its own chain of Translators, the next Translator
+// in a chain is tried when the previous one fails or returns an empty translation
+type RoutedTranslator struct {
+	Routes  map[string][]Translator
+	Default []Translator
+}
+
+// ParseRoutes parses a spec like "de,fr,nl=deepl,google;*=google" into a RoutedTranslator, the
+// providers are looked up by name and "*" sets the chain for all other languages
+func ParseRoutes(spec string, providers map[string]Translator) (*RoutedTranslator, error) {
+	r := &RoutedTranslator{Routes: make(map[string][]Translator)}
+	for _, route := range strings.Split(spec, ";") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		parts := strings.SplitN(route, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("routes: '%s' should look like 'lang,lang=provider,provider'", route)
+		}
+
+		// Build the chain of providers
+		var chain []Translator
+		for _, name := range strings.Split(parts[1], ",") {
+			name = strings.TrimSpace(name)
+			t, ok := providers[name]
+			if !ok {
+				return nil, fmt.Errorf("routes: unknown provider '%s'", name)
+			}
+			chain = append(chain, t)
+		}
+
+		// Assign the chain to every language
+		for _, lang := range strings.Split(parts[0], ",") {
+			lang = strings.TrimSpace(lang)
+			if lang == "*" {
+				r.Default = chain
+				continue
+			}
+			if _, ok := gLangs[lang]; !ok {
+				return nil, fmt.Errorf("routes: unknown language '%s'", lang)
+			}
+			r.Routes[lang] = chain
+		}
+	}
+	return r, nil
+}
+
+func (r *RoutedTranslator) Name() string {
+	return "routes"
+}
+
+// Chain returns the Translators that handle target, in order
+func (r *RoutedTranslator) Chain(target string) []Translator {
+	if chain, ok := r.Routes[target]; ok {
+		return chain
+	}
+	return r.Default
+}
+
+func (r *RoutedTranslator) Translate(text string, source string, target string) (string, error) {
+	chain := r.Chain(target)
+	if len(chain) == 0 {
+		return "", fmt.Errorf("routes: no provider for language '%s'", target)
+	}
+
+	// Try every provider in the chain and collect their errors
+	var errs []string
+	for _, t := range chain {
+		translation, err := t.Translate(text, source, target)
+		if err == nil && translation != "" {
+			return translation, nil
+		}
+		if err == nil {
+			err = ErrNoTranslation
+		}
+		errs = append(errs, t.Name()+": "+err.Error())
+	}
+	return "", errors.New(strings.Join(errs, "; "))
+}
+
+// TranslateBatch translates texts with the first provider of the chain, texts that are left
+// untranslated are passed on to the next provider
+func (r *RoutedTranslator) TranslateBatch(texts []string, source string, target string) ([]string, error) {
+	return r.TranslateContext(texts, "", source, target)
+}
+
+// TranslateContext passes the context on to the providers of the chain that support it
+func (r *RoutedTranslator) TranslateContext(texts []string, context string, source string, target string) ([]string, error) {
+	chain := r.Chain(target)
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("routes: no provider for language '%s'", target)
+	}
+
+	translations := make([]string, len(texts))
+	pending := make([]int, len(texts))
+	for i := range texts {
+		pending[i] = i
+	}
+	var errs []string
+	for _, t := range chain {
+
+		// Translate the texts that are still pending
+		todo := make([]string, len(pending))
+		var contexts []string
+		for j, i := range pending {
+			todo[j] = texts[i]
+			if context != "" {
+				contexts = append(contexts, context)
+			}
+		}
+		result, err := translateBatch(t, todo, contexts, source, target)
+		if err != nil {
+			errs = append(errs, t.Name()+": "+err.Error())
+		}
+
+		var still []int
+		for j, i := range pending {
+			if result[j] != "" {
+				translations[i] = result[j]
+			} else {
+				still = append(still, i)
+			}
+		}
+		pending = still
+		if len(pending) == 0 {
+			return translations, nil
+		}
+	}
+	if len(errs) == 0 {
+		errs = append(errs, ErrNoTranslation.Error())
+	}
+	return translations, errors.New(strings.Join(errs, "; "))
+}
+
+// chains returns the default chain followed by the chains of the routes, sorted by language
+func (r *RoutedTranslator) chains() [][]Translator {
+	chains := [][]Translator{r.Default}
+	var langs []string
+	for lang := range r.Routes {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		chains = append(chains, r.Routes[lang])
+	}
+	return chains
+}
+
+// CanDetect returns true when a provider of any chain detects languages
+func (r *RoutedTranslator) CanDetect() bool {
+	for _, chain := range r.chains() {
+		for _, t := range chain {
+			if canDetect(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Detect uses the first provider that detects languages, starting with the default chain
+func (r *RoutedTranslator) Detect(texts []string) ([]Detection, error) {
+	var errs []string
+	tried := make(map[string]bool)
+	for _, chain := range r.chains() {
+		for _, t := range chain {
+			if !canDetect(t) || tried[t.Name()] {
+				continue
+			}
+			tried[t.Name()] = true
+			detections, err := detect(t, texts)
+			if err == nil {
+				return detections, nil
+			}
+			errs = append(errs, t.Name()+": "+err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoDetector
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+// Languages returns every language that is supported by at least one provider of its chain
+func (r *RoutedTranslator) Languages() []string {
+	var langs []string
+	for lang := range gLangs {
+		for _, t := range r.Chain(lang) {
+			if supports(t, lang) {
+				langs = append(langs, lang)
+				break
+			}
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// supports returns true when lang is one of the Languages of t
+func supports(t Translator, lang string) bool {
+	for _, l := range t.Languages() {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
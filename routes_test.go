@@ -0,0 +1,65 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingTranslator fails for every language
+type failingTranslator struct{}
+
+func (f failingTranslator) Name() string {
+	return "failing"
+}
+
+func (f failingTranslator) Translate(text string, source string, target string) (string, error) {
+	return "", errors.New("service unavailable")
+}
+
+func (f failingTranslator) Languages() []string {
+	return []string{"de", "fr", "nl"}
+}
+
+func TestRoutes(t *testing.T) {
+	providers := map[string]Translator{
+		"test":    testTranslator{},
+		"failing": failingTranslator{},
+	}
+
+	for _, spec := range []string{"de=unknown", "xx=test", "de"} {
+		if _, err := ParseRoutes(spec, providers); err == nil {
+			t.Errorf("Expected an error for '%s'", spec)
+		}
+	}
+
+	r, err := ParseRoutes("de, fr = failing, test; nl=failing; *=test", providers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("Fall back to the next provider")
+	translation, err := r.Translate("Hello", "en", "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translation != "[de] Hello" {
+		t.Errorf("Unexpected translation: '%s'", translation)
+	}
+
+	t.Log("Fail when all providers fail")
+	if _, err := r.Translate("Hello", "en", "nl"); err == nil {
+		t.Errorf("Expected an error when all providers fail")
+	}
+
+	t.Log("Use the default chain")
+	if _, err := r.Translate("Hello", "en", "es"); err != nil {
+		t.Error(err)
+	}
+
+	langs := r.Languages()
+	if len(langs) != 3 {
+		t.Errorf("Unexpected languages: %v", langs)
+	}
+}
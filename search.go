@@ -0,0 +1,294 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"html"
+	"labix.org/v2/mgo/bson"
+	"net/url"
+	"sort"
+	"strings"
+	"translation.io/rest"
+	"unicode"
+)
+
+// tokenSpans returns the start and end of every word in text
+func tokenSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		} else if !word && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// tokenize returns the unique lowercase words of text, in order
+func tokenize(text string) []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, span := range tokenSpans(text) {
+		token := strings.ToLower(text[span[0]:span[1]])
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// stringTokens returns the words of the source text and all Translations of s, which are indexed by a Store
+func stringTokens(s *String) []string {
+	text := s.String
+	for _, translation := range s.Translations {
+		text += " " + translation
+	}
+	return tokenize(text)
+}
+
+// objectIds and resultsById sort in the order the Strings were created
+type objectIds []bson.ObjectId
+
+func (ids objectIds) Len() int           { return len(ids) }
+func (ids objectIds) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+func (ids objectIds) Less(i, j int) bool { return ids[i] < ids[j] }
+
+type resultsById []SearchResult
+
+func (rs resultsById) Len() int           { return len(rs) }
+func (rs resultsById) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
+func (rs resultsById) Less(i, j int) bool { return rs[i].String.Id < rs[j].String.Id }
+
+// searchPage returns at most limit of the ids that a Store found, in the order they were created and
+// starting after the id after
+func searchPage(found map[bson.ObjectId]bool, after bson.ObjectId, limit int) []bson.ObjectId {
+	var ids []bson.ObjectId
+	for id := range found {
+		if after == "" || id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(objectIds(ids))
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+// highlight wraps the words of text that are in terms with <em>, and escapes the rest as HTML
+func highlight(text string, terms map[string]bool) (string, bool) {
+	out := ""
+	last := 0
+	found := false
+	for _, span := range tokenSpans(text) {
+		if !terms[strings.ToLower(text[span[0]:span[1]])] {
+			continue
+		}
+		out += html.EscapeString(text[last:span[0]]) + "<em>" + html.EscapeString(text[span[0]:span[1]]) + "</em>"
+		last = span[1]
+		found = true
+	}
+	return out + html.EscapeString(text[last:]), found
+}
+
+// A SearchResult is a String with the fields that matched, highlighted by language or "String" for the source text
+type SearchResult struct {
+	String     String
+	Highlights map[string]string
+}
+
+// match returns a SearchResult when every term is found in the source text or a Translation of s,
+// or only in the Translation into lang when it's given
+func match(s *String, terms []string, lang string) (SearchResult, bool) {
+	fields := map[string]string{"String": s.String}
+	if lang != "" {
+		fields = map[string]string{lang: s.Translations[lang]}
+	} else {
+		for l, translation := range s.Translations {
+			fields[l] = translation
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, text := range fields {
+		for _, token := range tokenize(text) {
+			found[token] = true
+		}
+	}
+	wanted := make(map[string]bool)
+	for _, term := range terms {
+		if !found[term] {
+			return SearchResult{}, false
+		}
+		wanted[term] = true
+	}
+
+	result := SearchResult{String: *s, Highlights: make(map[string]string)}
+	for field, text := range fields {
+		if h, ok := highlight(text, wanted); ok {
+			result.Highlights[field] = h
+		}
+	}
+	return result, true
+}
+
+// A searchQuery finds Strings with all Terms, optionally only in the Translation into Lang
+type searchQuery struct {
+	Terms []string
+	Lang  string
+	Limit int
+}
+
+// parseSearch validates the q, lang and limit params, a non-nil response is a 422 error
+func parseSearch(v *url.Values) (searchQuery, rest.APIResponse) {
+	var q searchQuery
+	var res rest.APIResponse
+	q.Terms = tokenize(v.Get("q"))
+	if len(q.Terms) == 0 {
+		_, res = invalidParam("q", "A query with at least one word is required.")
+		return q, res
+	}
+	q.Lang = v.Get("lang")
+	if _, ok := gLangs[q.Lang]; q.Lang != "" && !ok {
+		_, res = invalidParam("lang", "The language '"+q.Lang+"' is not supported.")
+		return q, res
+	}
+	var ok bool
+	q.Limit, ok = limitParam(v)
+	if !ok {
+		_, res = invalidParam("limit", limitMessage)
+	}
+	return q, res
+}
+
+// search matches the candidates of a Store search, applying the Overrides of c when it's given
+func (q searchQuery) search(candidates []String, c *Collection) []SearchResult {
+	results := []SearchResult{}
+	for i := range candidates {
+		if c != nil {
+			c.Apply(&candidates[i])
+		}
+		if result, ok := match(&candidates[i], q.Terms, q.Lang); ok {
+			results = append(results, result)
+			if len(results) == q.Limit {
+				break
+			}
+		}
+	}
+	return results
+}
+
+// find matches the candidates of a Store search page by page until Limit Strings matched, so that no
+// more than a page of candidates is loaded at once
+func (q searchQuery) find(text string, within []bson.ObjectId, c *Collection) ([]SearchResult, error) {
+	results := []SearchResult{}
+	var after bson.ObjectId
+	for {
+		candidates, err := store.SearchStrings(text, within, after, q.Limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, q.search(candidates, c)...)
+		if len(results) >= q.Limit || len(candidates) < q.Limit {
+			break
+		}
+		after = candidates[len(candidates)-1].Id
+	}
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// Search returns the Strings of the Collection that match q, including the Overrides of the Collection
+func (c *CollectionStrings) Search(v *url.Values) (int, rest.APIResponse) {
+	q, res := parseSearch(v)
+	if res != nil {
+		return 422, res
+	}
+
+	// Overrides are not in the index of the Store, so Strings with Overrides are matched separately
+	ids := make([]bson.ObjectId, 0, len(c.Collection.Strings))
+	var overridden []bson.ObjectId
+	for _, s := range c.Collection.Strings {
+		if _, ok := c.Collection.Overrides[s.Id.Hex()]; ok {
+			overridden = append(overridden, s.Id)
+		} else {
+			ids = append(ids, s.Id)
+		}
+	}
+	results, err := q.find(v.Get("q"), ids, &c.Collection)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+	if len(overridden) > 0 {
+		strs, err := store.FindStrings(overridden)
+		if err != nil {
+			return 500, rest.ServerError()
+		}
+		sortStrings(strs, "created")
+		results = append(results, q.search(strs, &c.Collection)...)
+		sort.Sort(resultsById(results))
+		if len(results) > q.Limit {
+			results = results[:q.Limit]
+		}
+	}
+
+	return 200, &rest.APISuccess{
+		"Results": results,
+		"Next": &[]rest.Rel{
+			rest.Rel{"GET": "/collections/" + c.Collection.Id.Hex() + "/strings/{StringId}"},
+		},
+	}
+}
+
+// StringSearch searches all Strings
+type StringSearch struct{}
+
+// Implements APIResponse interface
+func (s *StringSearch) ToJSON() string {
+	return rest.ParseAPIResponse(s)
+}
+
+func (s *StringSearch) Get(v *url.Values) (int, rest.APIResponse) {
+	q, res := parseSearch(v)
+	if res != nil {
+		return 422, res
+	}
+	results, err := q.find(v.Get("q"), nil, nil)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+	return 200, &rest.APISuccess{
+		"Results": results,
+		"Next": &[]rest.Rel{
+			rest.Rel{"GET": "/collections/{CollectionId}/strings",
+				"Params": "q, lang, limit",
+			},
+		},
+	}
+}
+
+func (s *StringSearch) Post(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(&[]rest.Rel{
+		rest.Rel{"GET": "/strings",
+			"Params": "q, lang, limit",
+		},
+	})
+}
+
+func (s *StringSearch) Put(v *url.Values) (int, rest.APIResponse) {
+	return s.Post(v)
+}
+
+func (s *StringSearch) Delete(v *url.Values) (int, rest.APIResponse) {
+	return s.Post(v)
+}
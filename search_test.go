@@ -0,0 +1,111 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"translation.io/rest"
+)
+
+func TestHighlight(t *testing.T) {
+	h, ok := highlight("Save <all> changes, save!", map[string]bool{"save": true})
+	if !ok || h != "<em>Save</em> &lt;all&gt; changes, <em>save</em>!" {
+		t.Errorf("Unexpected highlight: %s", h)
+	}
+	if _, ok := highlight("Nothing here", map[string]bool{"save": true}); ok {
+		t.Error("Highlighted text without any terms")
+	}
+}
+
+func TestSearch(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	translator = testTranslator{}
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Search")
+	c.Post(v)
+
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	v.Add("string", "Open file")
+	v.Add("string", "Close file")
+	cs.Post(v)
+	runJobs(t)
+
+	other := &CollectionStrings{}
+	o := &Collection{}
+	v = &url.Values{}
+	v.Set("name", "Other")
+	o.Post(v)
+	other.Collection.Id = o.Id
+	v = &url.Values{}
+	v.Set("string", "Open window")
+	other.Post(v)
+	runJobs(t)
+
+	type Results struct {
+		Results []SearchResult
+	}
+	get := func(r interface {
+		Get(*url.Values) (int, rest.APIResponse)
+	}, query string) Results {
+		v, _ := url.ParseQuery(query)
+		status, res := r.Get(&v)
+		if status != 200 {
+			t.Fatalf("Could not search, status: %d, %s", status, res.ToJSON())
+		}
+		var p Results
+		json.Unmarshal([]byte(res.ToJSON()), &p)
+		return p
+	}
+
+	t.Log("Search the Strings of a Collection")
+	p := get(cs, "q=open")
+	if len(p.Results) != 1 || p.Results[0].String.String != "Open file" {
+		t.Fatalf("Unexpected results: %v", p)
+	}
+	if p.Results[0].Highlights["String"] != "<em>Open</em> file" || p.Results[0].Highlights["de"] != "[de] <em>Open</em> file" {
+		t.Errorf("Unexpected highlights: %v", p.Results[0].Highlights)
+	}
+
+	t.Log("Search a language")
+	cs.String.Id = p.Results[0].String.Id
+	v = &url.Values{}
+	v.Set("lang", "nl")
+	v.Set("translation", "Bestand openen")
+	cs.Put(v)
+	cs.String.Id = ""
+	p = get(cs, "q=openen&lang=nl")
+	if len(p.Results) != 1 || p.Results[0].Highlights["nl"] != "Bestand <em>openen</em>" {
+		t.Errorf("Override was not found: %v", p)
+	}
+	if p = get(cs, "q=openen&lang=de"); len(p.Results) != 0 {
+		t.Errorf("Found a match in another language: %v", p)
+	}
+
+	t.Log("Search all Strings")
+	p = get(&StringSearch{}, "q=open")
+	if len(p.Results) != 2 {
+		t.Errorf("Unexpected results: %v", p)
+	}
+	if status, _ := (&StringSearch{}).Get(&url.Values{}); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("Search pages through candidates that don't match")
+	store.SetTranslation(cs.Collection.Strings[0].Id, "nl", "Bestand openen")
+	p = get(&StringSearch{}, "q=file&lang=nl&limit=1")
+	if len(p.Results) != 1 || p.Results[0].String.String != "Close file" {
+		t.Errorf("Unexpected results: %v", p)
+	}
+	p = get(cs, "q=file&limit=1")
+	if len(p.Results) != 1 || p.Results[0].String.String != "Open file" {
+		t.Errorf("Unexpected results of a Collection: %v", p)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"errors"
+	"labix.org/v2/mgo/bson"
+	"translation.io/rest"
+)
+
+// ErrNotFound is returned by a Store when a document does not exist
+var ErrNotFound = errors.New("not found")
+
+// The Store that is used by all Resources, set in main()
+var store Store
+
+// All storage backends need to implement this interface
+type Store interface {
+
+	// Collections are listed in the order they were created, optionally filtered by a part of their
+	// name. Inserting or updating a Collection sets its Modified time.
+	FindCollection(id bson.ObjectId, c *Collection) error
+	FindCollections(name string, after bson.ObjectId, limit int) ([]Collection, error)
+	InsertCollection(c *Collection) error
+	UpdateCollection(c *Collection) error
+	RemoveCollection(id bson.ObjectId) error
+
+	// Strings are shared between all Collections and unique by text, source language and description,
+	// so InsertString loads the existing String into s instead of inserting a duplicate
+	FindString(id bson.ObjectId, s *String) error
+
+	// FindStrings skips ids that don't exist
+	FindStrings(ids []bson.ObjectId) ([]String, error)
+	FindStringByText(str string, source string, description string, s *String) error
+	InsertString(s *String) error
+	UpdateString(s *String) error
+	RemoveString(id bson.ObjectId) error
+
+	// SearchStrings uses an index of the words in the source text and Translations to find at most limit
+	// Strings that may contain all words of q, in the order they were created and starting after the
+	// String with id after, unless it's empty. Only the Strings with ids in within are searched, unless
+	// within is nil. Candidates are matched exactly with match().
+	SearchStrings(q string, within []bson.ObjectId, after bson.ObjectId, limit int) ([]String, error)
+
+	// Translations of a single String
+	SetTranslation(id bson.ObjectId, lang string, translation string) error
+	RemoveTranslation(id bson.ObjectId, lang string) error
+
+	// Jobs
+	FindJob(id bson.ObjectId, j *Job) error
+	FindJobs(states []string) ([]Job, error)
+	FindCollectionJobs(id bson.ObjectId) ([]Job, error)
+	InsertJob(j *Job) error
+	UpdateJob(j *Job) error
+
+	// Webhooks and the log of their Deliveries
+	FindWebhook(id bson.ObjectId, w *Webhook) error
+	FindWebhooks(collectionId bson.ObjectId) ([]Webhook, error)
+	InsertWebhook(w *Webhook) error
+	RemoveWebhook(id bson.ObjectId) error
+	FindDelivery(id bson.ObjectId, d *Delivery) error
+	FindDeliveries(states []string) ([]Delivery, error)
+	FindWebhookDeliveries(id bson.ObjectId) ([]Delivery, error)
+	InsertDelivery(d *Delivery) error
+	UpdateDelivery(d *Delivery) error
+}
+
+// textKey identifies a String by its text, source language and description
+func textKey(str string, source string, description string) string {
+	key := str
+	if description != "" {
+		key += "\x00" + description
+	}
+	if source = sourceLang(source); source != defaultSource {
+		key += "\x01" + source
+	}
+	return key
+}
+
+// storeError converts a Store error into an APIResponse
+func storeError(err error) (int, rest.APIResponse) {
+	if err == ErrNotFound {
+		return 404, rest.NotFoundError()
+	}
+	return 500, rest.ServerError()
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testStore runs the same checks against every Store implementation
+func testStore(t *testing.T, s Store) {
+
+	t.Log("Collection not found")
+	var c Collection
+	if err := s.FindCollection(bson.NewObjectId(), &c); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+	if err := s.UpdateCollection(&Collection{Id: bson.NewObjectId()}); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound on update, got: %v", err)
+	}
+
+	t.Log("Insert and find Collection")
+	c = Collection{Id: bson.NewObjectId(), Name: "Test", Source: "nl"}
+	if err := s.InsertCollection(&c); err != nil {
+		t.Fatal(err)
+	}
+	var found Collection
+	if err := s.FindCollection(c.Id, &found); err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "Test" || found.Modified.IsZero() {
+		t.Errorf("Unexpected Collection: %v", found)
+	}
+
+	t.Log("List Collections")
+	other := Collection{Id: bson.NewObjectId(), Name: "Other"}
+	s.InsertCollection(&other)
+	cs, err := s.FindCollections("tEs", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 1 || cs[0].Id != c.Id || cs[0].Source != "nl" {
+		t.Errorf("Unexpected Collections by name: %v", cs)
+	}
+	cs, _ = s.FindCollections("", c.Id, 10)
+	if len(cs) != 1 || cs[0].Id != other.Id {
+		t.Errorf("Unexpected Collections after cursor: %v", cs)
+	}
+	cs, _ = s.FindCollections("", "", 1)
+	if len(cs) != 1 || cs[0].Id != c.Id {
+		t.Errorf("Unexpected Collections with limit: %v", cs)
+	}
+
+	t.Log("Insert String twice")
+	str := String{Id: bson.NewObjectId(), String: "Hello", Translations: map[string]string{"nl": "Hallo"}}
+	if err := s.InsertString(&str); err != nil {
+		t.Fatal(err)
+	}
+	dup := String{Id: bson.NewObjectId(), String: "Hello"}
+	if err := s.InsertString(&dup); err != nil {
+		t.Fatal(err)
+	}
+	if dup.Id != str.Id || dup.Translations["nl"] != "Hallo" {
+		t.Errorf("InsertString is not idempotent: %v", dup)
+	}
+	t.Log("Insert the same String concurrently")
+	var wg sync.WaitGroup
+	ids := make([]bson.ObjectId, 10)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			concurrent := String{Id: bson.NewObjectId(), String: "Concurrent"}
+			if err := s.InsertString(&concurrent); err != nil {
+				t.Error(err)
+			}
+			ids[i] = concurrent.Id
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("Concurrent inserts created several Strings: %v", ids)
+			break
+		}
+	}
+	s.RemoveString(ids[0])
+
+	described := String{Id: bson.NewObjectId(), String: "Hello", Description: "Greeting on the phone"}
+	if err := s.InsertString(&described); err != nil {
+		t.Fatal(err)
+	}
+	var byDescription String
+	if err := s.FindStringByText("Hello", "en", "Greeting on the phone", &byDescription); err != nil {
+		t.Fatal(err)
+	}
+	if described.Id == str.Id || byDescription.Id != described.Id || byDescription.Description != "Greeting on the phone" {
+		t.Errorf("A String with a description is not a different String: %v", byDescription)
+	}
+	s.RemoveString(described.Id)
+	japanese := String{Id: bson.NewObjectId(), String: "Hello", Source: "ja"}
+	if err := s.InsertString(&japanese); err != nil {
+		t.Fatal(err)
+	}
+	if japanese.Id == str.Id {
+		t.Errorf("A String in another source language is not a different String")
+	}
+	s.RemoveString(japanese.Id)
+
+	t.Log("Find several Strings")
+	strs, err := s.FindStrings([]bson.ObjectId{bson.NewObjectId(), str.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strs) != 1 || strs[0].String != "Hello" {
+		t.Errorf("Unexpected Strings: %v", strs)
+	}
+
+	t.Log("Update Collection with Strings, Overrides and Contexts")
+	c.Strings = []String{str}
+	c.SetOverride(str.Id, "nl", "Hoi")
+	c.SetContext(str.Id, "https://example.com/hello.png", 10)
+	if err := s.UpdateCollection(&c); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FindCollection(c.Id, &found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found.Strings) != 1 || found.Overrides[str.Id.Hex()]["nl"].Translation != "Hoi" || found.Contexts[str.Id.Hex()].MaxLength != 10 {
+		t.Errorf("Unexpected Collection: %v", found)
+	}
+
+	t.Log("Set and remove Translation")
+	if err := s.SetTranslation(str.Id, "de", "Hallo!"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveTranslation(str.Id, "nl"); err != nil {
+		t.Fatal(err)
+	}
+	var byText String
+	if err := s.FindStringByText("Hello", "", "", &byText); err != nil {
+		t.Fatal(err)
+	}
+	if byText.Translations["de"] != "Hallo!" {
+		t.Errorf("Translation was not set: %v", byText.Translations)
+	}
+	if _, ok := byText.Translations["nl"]; ok {
+		t.Errorf("Translation was not removed: %v", byText.Translations)
+	}
+	if err := s.SetTranslation(bson.NewObjectId(), "de", "Hallo"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	t.Log("Search Strings")
+	found2 := String{Id: bson.NewObjectId(), String: "Hello world"}
+	s.InsertString(&found2)
+	results, err := s.SearchStrings("HALLO", nil, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Id != str.Id {
+		t.Errorf("Unexpected results for a translation: %v", results)
+	}
+	results, _ = s.SearchStrings("hello", nil, "", 10)
+	if len(results) != 2 || results[0].Id != str.Id {
+		t.Errorf("Unexpected results for a source text: %v", results)
+	}
+	results, _ = s.SearchStrings("hello world", nil, "", 10)
+	if len(results) != 1 || results[0].Id != found2.Id {
+		t.Errorf("Unexpected results for all words: %v", results)
+	}
+	results, _ = s.SearchStrings("hello", []bson.ObjectId{found2.Id}, "", 10)
+	if len(results) != 1 || results[0].Id != found2.Id {
+		t.Errorf("Unexpected results within ids: %v", results)
+	}
+	results, _ = s.SearchStrings("hello", nil, "", 1)
+	if len(results) != 1 || results[0].Id != str.Id {
+		t.Errorf("Unexpected results with limit: %v", results)
+	}
+	results, _ = s.SearchStrings("hello", nil, str.Id, 1)
+	if len(results) != 1 || results[0].Id != found2.Id {
+		t.Errorf("Unexpected results after a String: %v", results)
+	}
+	if err := s.RemoveTranslation(str.Id, "de"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ = s.SearchStrings("hallo", nil, "", 10); len(results) != 0 {
+		t.Errorf("Removed translation is still found: %v", results)
+	}
+	s.SetTranslation(str.Id, "de", "Hallo!")
+	if err := s.RemoveString(found2.Id); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ = s.SearchStrings("world", nil, "", 10); len(results) != 0 {
+		t.Errorf("Removed String is still found: %v", results)
+	}
+
+	t.Log("Insert, update and find Jobs")
+	j := Job{Id: bson.NewObjectId(), CollectionId: c.Id, StringIds: []bson.ObjectId{str.Id}, State: JobQueued}
+	if err := s.InsertJob(&j); err != nil {
+		t.Fatal(err)
+	}
+	j2 := Job{Id: bson.NewObjectId(), CollectionId: c.Id, State: JobQueued}
+	s.InsertJob(&j2)
+	j2.State = JobDone
+	if err := s.UpdateJob(&j2); err != nil {
+		t.Fatal(err)
+	}
+	queued, err := s.FindJobs([]string{JobQueued, JobRunning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].Id != j.Id || queued[0].StringIds[0] != str.Id {
+		t.Errorf("Unexpected Jobs: %v", queued)
+	}
+	js, err := s.FindCollectionJobs(c.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(js) != 2 || js[0].Id != j.Id {
+		t.Errorf("Unexpected Jobs of Collection: %v", js)
+	}
+
+	t.Log("Insert, find and remove Webhooks")
+	w := Webhook{Id: bson.NewObjectId(), CollectionId: c.Id, URL: "http://localhost/hook", Events: []string{EventTranslated}}
+	if err := s.InsertWebhook(&w); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := s.FindWebhooks(c.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ws) != 1 || ws[0].URL != w.URL || ws[0].Events[0] != EventTranslated {
+		t.Errorf("Unexpected Webhooks: %v", ws)
+	}
+
+	t.Log("Insert, update and find Deliveries")
+	d := Delivery{Id: bson.NewObjectId(), WebhookId: w.Id, Event: EventTranslated, State: DeliveryPending}
+	if err := s.InsertDelivery(&d); err != nil {
+		t.Fatal(err)
+	}
+	d2 := Delivery{Id: bson.NewObjectId(), WebhookId: w.Id, Event: EventFailed, State: DeliveryPending}
+	s.InsertDelivery(&d2)
+	d2.State = DeliveryDelivered
+	if err := s.UpdateDelivery(&d2); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := s.FindDeliveries([]string{DeliveryPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Id != d.Id {
+		t.Errorf("Unexpected Deliveries: %v", pending)
+	}
+	ds, err := s.FindWebhookDeliveries(w.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[1].State != DeliveryDelivered {
+		t.Errorf("Unexpected Deliveries of Webhook: %v", ds)
+	}
+	if err := s.RemoveWebhook(w.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FindWebhook(w.Id, &w); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	t.Log("Remove String and Collection")
+	if err := s.RemoveString(str.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FindString(str.Id, &byText); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+	if err := s.RemoveCollection(c.Id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "translation.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.db")
+
+	b, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, b)
+
+	t.Log("Reopen with migrations applied")
+	c := Collection{Id: bson.NewObjectId(), Name: "Persisted"}
+	if err := b.InsertCollection(&c); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	b, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.FindCollection(c.Id, &c); err != nil {
+		t.Errorf("Collection was not persisted: %v", err)
+	}
+}
+
+// TestMongoStore needs a running mongod, it only runs when TEST_MONGO_URL is set
+func TestMongoStore(t *testing.T) {
+	path := os.Getenv("TEST_MONGO_URL")
+	if path == "" {
+		t.Skip("TEST_MONGO_URL is not set")
+	}
+	m := NewMongoStore(path, "transio_test_"+bson.NewObjectId().Hex())
+	session, _, err := m.C("strings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		session.DB(m.Db).DropDatabase()
+		session.Close()
+	}()
+	testStore(t, m)
+}
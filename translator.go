@@ -0,0 +1,264 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoTranslation is returned when a provider answers without a translation
+var ErrNoTranslation = errors.New("no translation returned")
+
+// ErrNoDetector is returned when no provider can detect the language of a text
+var ErrNoDetector = errors.New("no provider detects languages")
+
+// The Translator that is used by all Resources, set in main()
+var translator Translator
+
+// All configured providers by name
+var translators = make(map[string]Translator)
+
+// All translation providers need to implement this interface
+type Translator interface {
+
+	// Name of the provider, as used in configuration
+	Name() string
+
+	// Translate text from the source language into the target language
+	Translate(text string, source string, target string) (string, error)
+
+	// Languages returns the target languages that are supported
+	Languages() []string
+}
+
+// Translators that can translate several texts in one request implement this interface as well
+type BatchTranslator interface {
+	Translator
+
+	// TranslateBatch returns the translations of texts in the same order
+	TranslateBatch(texts []string, source string, target string) ([]string, error)
+}
+
+// Translators that can use a description of the texts, e.g. where they are shown, implement this interface as well
+type ContextTranslator interface {
+	BatchTranslator
+
+	// TranslateContext returns the translations of texts that share the same context in the same order
+	TranslateContext(texts []string, context string, source string, target string) ([]string, error)
+}
+
+// A Detection is the language of a text, with a confidence between 0 and 1
+type Detection struct {
+	Language   string
+	Confidence float64
+}
+
+// Translators that can detect the language of texts implement this interface as well
+type Detector interface {
+
+	// Detect returns the languages of texts in the same order, as codes of gLangs when they are supported
+	Detect(texts []string) ([]Detection, error)
+}
+
+// canDetect returns true when t is a Detector, a Detector that uses other providers tells whether
+// one of them detects languages
+func canDetect(t Translator) bool {
+	if c, ok := t.(interface {
+		CanDetect() bool
+	}); ok {
+		return c.CanDetect()
+	}
+	_, ok := t.(Detector)
+	return ok
+}
+
+// detect returns the languages of texts with the Detector of t
+func detect(t Translator, texts []string) ([]Detection, error) {
+	d, ok := t.(Detector)
+	if !ok || !canDetect(t) {
+		return nil, ErrNoDetector
+	}
+	detections, err := d.Detect(texts)
+	if err == nil && len(detections) != len(texts) {
+		err = fmt.Errorf("%s: expected %d detections, got %d", t.Name(), len(texts), len(detections))
+	}
+	return detections, err
+}
+
+// Batches sent to a BatchTranslator are bounded by number of texts and characters
+var maxBatchSize = 50
+var maxBatchChars = 5000
+
+// batches splits texts into batches of at most maxBatchSize texts and maxBatchChars characters
+func batches(texts []string) [][]string {
+	var all [][]string
+	var batch []string
+	chars := 0
+	for _, text := range texts {
+		if len(batch) > 0 && (len(batch) == maxBatchSize || chars+len(text) > maxBatchChars) {
+			all = append(all, batch)
+			batch = nil
+			chars = 0
+		}
+		batch = append(batch, text)
+		chars += len(text)
+	}
+	if len(batch) > 0 {
+		all = append(all, batch)
+	}
+	return all
+}
+
+// translateBatch translates texts into target in as few requests as t allows, texts that
+// can't be translated are left empty and the last error is returned. The contexts of the texts
+// are optional and only used by a ContextTranslator.
+func translateBatch(t Translator, texts []string, contexts []string, source string, target string) ([]string, error) {
+	translations := make([]string, len(texts))
+	var lastErr error
+
+	// Translate one text at a time
+	bt, ok := t.(BatchTranslator)
+	if !ok {
+		for i, text := range texts {
+			translation, err := t.Translate(text, source, target)
+			if err == nil && translation == "" {
+				err = ErrNoTranslation
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			translations[i] = translation
+		}
+		return translations, lastErr
+	}
+
+	// Texts with the same context are translated together by a ContextTranslator
+	ct, ok := t.(ContextTranslator)
+	var order []string
+	groups := make(map[string][]int)
+	for i := range texts {
+		context := ""
+		if ok && contexts != nil {
+			context = contexts[i]
+		}
+		if _, seen := groups[context]; !seen {
+			order = append(order, context)
+		}
+		groups[context] = append(groups[context], i)
+	}
+
+	// Translate every group in bounded batches
+	for _, context := range order {
+		group := groups[context]
+		todo := make([]string, len(group))
+		for j, i := range group {
+			todo[j] = texts[i]
+		}
+		j := 0
+		for _, batch := range batches(todo) {
+			var result []string
+			var err error
+			if context != "" {
+				result, err = ct.TranslateContext(batch, context, source, target)
+			} else {
+				result, err = bt.TranslateBatch(batch, source, target)
+			}
+			if err == nil && len(result) != len(batch) {
+				err = fmt.Errorf("%s: expected %d translations, got %d", t.Name(), len(batch), len(result))
+			}
+			if err != nil {
+				lastErr = err
+			} else {
+				for k, translation := range result {
+					translations[group[j+k]] = translation
+				}
+			}
+			j += len(batch)
+		}
+	}
+	return translations, lastErr
+}
+
+type Translation struct {
+	Language     string
+	Translations []string
+	Err          error
+}
+
+// TranslationFailure records why (some texts of) a language could not be translated
+type TranslationFailure struct {
+	Language string
+	Reason   string
+	Status   int `json:",omitempty"`
+}
+
+// translateAll translates texts into all langs, one goroutine per language. The translations of
+// every text are returned in the same order as texts, languages that can't be translated are left
+// out and reported as failures. contexts describe the texts and may be nil. todo has the languages
+// that every text still needs, texts are translated into all langs when it's nil.
+func translateAll(t Translator, texts []string, contexts []string, todo []map[string]bool, source string, langs []string) ([]map[string]string, []TranslationFailure) {
+
+	// Create channel
+	ch := make(chan Translation)
+
+	// Create a goroutine for every language and collect the results into the channel
+	for _, lang := range langs {
+		go func(lang string) {
+
+			// Only the texts that need the language are sent to the provider
+			var indexes []int
+			var needed, neededContexts []string
+			for i, text := range texts {
+				if todo == nil || todo[i][lang] {
+					indexes = append(indexes, i)
+					needed = append(needed, text)
+					if contexts != nil {
+						neededContexts = append(neededContexts, contexts[i])
+					}
+				}
+			}
+			translations := make([]string, len(texts))
+			var err error
+			if len(needed) > 0 {
+				var result []string
+				result, err = translateBatch(t, needed, neededContexts, source, lang)
+				for k, i := range indexes {
+					translations[i] = result[k]
+				}
+			}
+			ch <- Translation{
+				Language:     lang,
+				Translations: translations,
+				Err:          err,
+			}
+		}(lang)
+	}
+
+	// Wait for the goroutines to finish
+	all := make([]map[string]string, len(texts))
+	for i := range all {
+		all[i] = make(map[string]string)
+	}
+	var failures []TranslationFailure
+	for i := 0; i < len(langs); i++ {
+		translation := <-ch
+		for j, text := range translation.Translations {
+			if text != "" {
+				all[j][translation.Language] = text
+			}
+		}
+		if translation.Err != nil {
+			failure := TranslationFailure{
+				Language: translation.Language,
+				Reason:   translation.Err.Error(),
+			}
+			if e, ok := translation.Err.(*HTTPError); ok {
+				failure.Status = e.StatusCode
+			}
+			failures = append(failures, failure)
+		}
+	}
+	return all, failures
+}
@@ -0,0 +1,487 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+	"translation.io/rest"
+)
+
+// Events that can be sent to Webhooks
+var webhookEvents = []string{EventTranslated, EventFailed, EventEdited}
+
+// A Webhook receives the Events of a Collection it subscribed to, signed with its Secret
+type Webhook struct {
+	Id           bson.ObjectId `bson:"_id"`
+	CollectionId bson.ObjectId
+	URL          string
+	Events       []string
+	Secret       string `json:"-"`
+	Created      time.Time
+}
+
+// Subscribed returns true when the Webhook receives events of type event
+func (w *Webhook) Subscribed(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// States of a Delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// A Delivery is a single Event sent to a Webhook, Deliveries are kept as a log
+type Delivery struct {
+	Id         bson.ObjectId `bson:"_id"`
+	WebhookId  bson.ObjectId
+	Event      string
+	Payload    string
+	State      string
+	Attempts   int
+	StatusCode int    `bson:",omitempty" json:",omitempty"`
+	Error      string `bson:",omitempty" json:",omitempty"`
+	Created    time.Time
+	Delivered  time.Time `bson:",omitempty" json:",omitempty"`
+}
+
+// webhooksById and deliveriesById sort in the order they were created
+type webhooksById []Webhook
+
+func (ws webhooksById) Len() int           { return len(ws) }
+func (ws webhooksById) Swap(i, j int)      { ws[i], ws[j] = ws[j], ws[i] }
+func (ws webhooksById) Less(i, j int) bool { return ws[i].Id < ws[j].Id }
+
+type deliveriesById []Delivery
+
+func (ds deliveriesById) Len() int           { return len(ds) }
+func (ds deliveriesById) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
+func (ds deliveriesById) Less(i, j int) bool { return ds[i].Id < ds[j].Id }
+
+// Sign returns the signature of a payload that is sent in the X-Translation-Signature header
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// The Dispatcher that sends all Deliveries, set in main() once the configuration is read
+var hooks *Dispatcher
+
+// Dispatcher sends Deliveries to Webhooks and retries them with backoff, Deliveries are kept in
+// the Store so they survive restarts
+type Dispatcher struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	HTTP        *http.Client
+
+	mu        sync.Mutex
+	running   bool
+	scheduled map[bson.ObjectId]bool
+	queues    map[bson.ObjectId][]bson.ObjectId
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		MaxAttempts: 5,
+		Backoff:     30 * time.Second,
+		HTTP:        &http.Client{Timeout: clientTimeout},
+		scheduled:   make(map[bson.ObjectId]bool),
+		queues:      make(map[bson.ObjectId][]bson.ObjectId),
+	}
+}
+
+// Start starts sending and resends the Deliveries that were pending when the server stopped
+func (d *Dispatcher) Start() error {
+	d.mu.Lock()
+	d.running = true
+	d.mu.Unlock()
+
+	pending, err := store.FindDeliveries([]string{DeliveryPending})
+	if err != nil {
+		return err
+	}
+	for i := range pending {
+		d.schedule(&pending[i], 0)
+	}
+	return nil
+}
+
+// schedule hands a Delivery to the sender of its Webhook after a delay, if the Dispatcher is
+// running. A Delivery that is already scheduled is not scheduled twice
+func (d *Dispatcher) schedule(delivery *Delivery, delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.running || d.scheduled[delivery.Id] {
+		return
+	}
+	d.scheduled[delivery.Id] = true
+	id, webhookId := delivery.Id, delivery.WebhookId
+	time.AfterFunc(delay, func() {
+		d.enqueue(webhookId, id)
+	})
+}
+
+// enqueue adds a Delivery to the queue of its Webhook, every Webhook has its own sender so a slow
+// endpoint only holds up its own Deliveries
+func (d *Dispatcher) enqueue(webhookId, id bson.ObjectId) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	queue, sending := d.queues[webhookId]
+	d.queues[webhookId] = append(queue, id)
+	if !sending {
+		go d.drain(webhookId)
+	}
+}
+
+// drain sends the queued Deliveries of a Webhook one by one and stops when the queue is empty
+func (d *Dispatcher) drain(webhookId bson.ObjectId) {
+	for {
+		d.mu.Lock()
+		queue := d.queues[webhookId]
+		if len(queue) == 0 {
+			delete(d.queues, webhookId)
+			d.mu.Unlock()
+			return
+		}
+		id := queue[0]
+		d.queues[webhookId] = queue[1:]
+		delete(d.scheduled, id)
+		d.mu.Unlock()
+
+		err := d.Deliver(id)
+		if err != nil {
+			fmt.Println("Delivery " + id.Hex() + " could not be sent: " + err.Error())
+		}
+	}
+}
+
+// Publish stores a Delivery of e for every Webhook of the Collection that subscribed to it
+func (d *Dispatcher) Publish(e Event) error {
+	ws, err := store.FindWebhooks(e.CollectionId)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	for _, w := range ws {
+		if !w.Subscribed(e.Type) {
+			continue
+		}
+		delivery := &Delivery{
+			Id:        bson.NewObjectId(),
+			WebhookId: w.Id,
+			Event:     e.Type,
+			Payload:   string(payload),
+			State:     DeliveryPending,
+			Created:   e.Created,
+		}
+		err = store.InsertDelivery(delivery)
+		if err != nil {
+			return err
+		}
+		d.schedule(delivery, 0)
+	}
+	return nil
+}
+
+// Deliver sends a pending Delivery, a Webhook that does not respond with 2xx is retried with backoff
+// until the Delivery runs out of attempts
+func (d *Dispatcher) Deliver(id bson.ObjectId) error {
+	var delivery Delivery
+	err := store.FindDelivery(id, &delivery)
+	if err != nil {
+		return err
+	}
+	if delivery.State != DeliveryPending {
+		return nil
+	}
+
+	var w Webhook
+	err = store.FindWebhook(delivery.WebhookId, &w)
+	if err == ErrNotFound {
+		delivery.State = DeliveryFailed
+		delivery.Error = "The webhook was removed."
+		return store.UpdateDelivery(&delivery)
+	} else if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	delivery.StatusCode, err = d.send(&w, &delivery)
+	if err == nil {
+		delivery.State = DeliveryDelivered
+		delivery.Error = ""
+		delivery.Delivered = time.Now()
+		return store.UpdateDelivery(&delivery)
+	}
+
+	delivery.Error = err.Error()
+	if delivery.Attempts < d.MaxAttempts {
+		err = store.UpdateDelivery(&delivery)
+		if err != nil {
+			return err
+		}
+		d.schedule(&delivery, d.Backoff*time.Duration(1<<uint(delivery.Attempts-1)))
+		return nil
+	}
+	delivery.State = DeliveryFailed
+	return store.UpdateDelivery(&delivery)
+}
+
+// send makes a single signed request to the Webhook
+func (d *Dispatcher) send(w *Webhook, delivery *Delivery) (int, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Translation-Event", delivery.Event)
+	req.Header.Set("X-Translation-Delivery", delivery.Id.Hex())
+	req.Header.Set("X-Translation-Signature", Sign(w.Secret, []byte(delivery.Payload)))
+
+	r, err := d.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Body.Close()
+	ioutil.ReadAll(r.Body)
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return r.StatusCode, fmt.Errorf("unexpected status %d", r.StatusCode)
+	}
+	return r.StatusCode, nil
+}
+
+// newSecret returns a random secret for a Webhook that was registered without one
+func newSecret() (string, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CollectionWebhooks registers Webhooks for the Events of a Collection
+type CollectionWebhooks struct {
+	Collection Collection
+	Webhook    Webhook
+}
+
+// Implements APIResponse interface
+func (c *CollectionWebhooks) ToJSON() string {
+	return rest.ParseAPIResponse(c)
+}
+
+// allowed returns the methods that are allowed on the Webhooks of a Collection
+func (c *CollectionWebhooks) allowed() *[]rest.Rel {
+	path := "/collections/" + c.Collection.Id.Hex() + "/webhooks"
+	return &[]rest.Rel{
+		rest.Rel{"GET": path},
+		rest.Rel{"POST": path,
+			"Params": "url, event, secret",
+		},
+		rest.Rel{"GET": path + "/{WebhookId}"},
+		rest.Rel{"DELETE": path + "/{WebhookId}"},
+		rest.Rel{"GET": path + "/{WebhookId}/deliveries"},
+	}
+}
+
+// find loads the Collection and, when an id was given, its Webhook
+func (c *CollectionWebhooks) find() (int, rest.APIResponse) {
+	err := store.FindCollection(c.Collection.Id, &c.Collection)
+	if err != nil {
+		return storeError(err)
+	}
+	if c.Webhook.Id.Valid() {
+		err = store.FindWebhook(c.Webhook.Id, &c.Webhook)
+		if err != nil {
+			return storeError(err)
+		}
+		if c.Webhook.CollectionId != c.Collection.Id {
+			return 404, rest.NotFoundError()
+		}
+	}
+	return 200, nil
+}
+
+func (c *CollectionWebhooks) Get(v *url.Values) (int, rest.APIResponse) {
+	if status, res := c.find(); status != 200 {
+		return status, res
+	}
+
+	// Return single Webhook
+	if c.Webhook.Id.Valid() {
+		return 200, &rest.APISuccess{
+			"Webhook": c.Webhook,
+			"Next":    c.allowed(),
+		}
+	}
+
+	ws, err := store.FindWebhooks(c.Collection.Id)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+	if ws == nil {
+		ws = []Webhook{}
+	}
+	return 200, &rest.APISuccess{
+		"Webhooks": ws,
+		"Next":     c.allowed(),
+	}
+}
+
+func (c *CollectionWebhooks) Post(v *url.Values) (int, rest.APIResponse) {
+	if c.Webhook.Id.Valid() {
+		return 405, rest.InvalidMethodError(c.allowed())
+	}
+	if status, res := c.find(); status != 200 {
+		return status, res
+	}
+
+	// Validate URL
+	u, err := url.Parse(v.Get("url"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 422, &rest.APIError{
+			Error: rest.ErrorMsg{
+				Type:    "invalid-url",
+				Message: "An absolute http or https url is required.",
+				Code:    422,
+				Param:   []string{"url"},
+			},
+		}
+	}
+
+	// Validate events, a Webhook receives all events by default
+	events := listParam(v, "event")
+	for _, event := range events {
+		known := false
+		for _, e := range webhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return 422, &rest.APIError{
+				Error: rest.ErrorMsg{
+					Type:    "invalid-event",
+					Message: "The event '" + event + "' does not exist.",
+					Code:    422,
+					Param:   []string{"event"},
+				},
+			}
+		}
+	}
+	if len(events) == 0 {
+		events = webhookEvents
+	}
+
+	// The secret is only returned once, when it's not given one is generated
+	secret := v.Get("secret")
+	if secret == "" {
+		secret, err = newSecret()
+		if err != nil {
+			return 500, rest.ServerError()
+		}
+	}
+
+	c.Webhook = Webhook{
+		Id:           bson.NewObjectId(),
+		CollectionId: c.Collection.Id,
+		URL:          u.String(),
+		Events:       events,
+		Secret:       secret,
+		Created:      time.Now(),
+	}
+	err = store.InsertWebhook(&c.Webhook)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+
+	return 200, &rest.APISuccess{
+		"Webhook": c.Webhook,
+		"Secret":  secret,
+		"Next":    c.allowed(),
+	}
+}
+
+func (c *CollectionWebhooks) Put(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(c.allowed())
+}
+
+func (c *CollectionWebhooks) Delete(v *url.Values) (int, rest.APIResponse) {
+	if !c.Webhook.Id.Valid() {
+		return 405, rest.InvalidMethodError(c.allowed())
+	}
+	if status, res := c.find(); status != 200 {
+		return status, res
+	}
+
+	err := store.RemoveWebhook(c.Webhook.Id)
+	if err != nil {
+		return storeError(err)
+	}
+	return 200, &rest.APISuccess{
+		"Success": true,
+		"Next":    c.allowed(),
+	}
+}
+
+// maxDeliveries is the number of Deliveries that are returned in the log of a Webhook
+const maxDeliveries = 100
+
+// WebhookDeliveries is the log of the most recent Deliveries of a Webhook
+type WebhookDeliveries struct {
+	CollectionWebhooks
+}
+
+func (w *WebhookDeliveries) Get(v *url.Values) (int, rest.APIResponse) {
+	if status, res := w.find(); status != 200 {
+		return status, res
+	}
+
+	ds, err := store.FindWebhookDeliveries(w.Webhook.Id)
+	if err != nil {
+		return 500, rest.ServerError()
+	}
+
+	// Newest first
+	sort.Sort(sort.Reverse(deliveriesById(ds)))
+	if len(ds) > maxDeliveries {
+		ds = ds[:maxDeliveries]
+	}
+	if ds == nil {
+		ds = []Delivery{}
+	}
+	return 200, &rest.APISuccess{
+		"Deliveries": ds,
+		"Next":       w.allowed(),
+	}
+}
+
+func (w *WebhookDeliveries) Post(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(w.allowed())
+}
+
+func (w *WebhookDeliveries) Delete(v *url.Values) (int, rest.APIResponse) {
+	return 405, rest.InvalidMethodError(w.allowed())
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2013 Melvin Tercan, https://github.com/melvinmt
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+
+	store = NewMemoryStore()
+	jobs = NewJobQueue(0)
+	hooks = NewDispatcher()
+	translator = testTranslator{}
+
+	// The receiver fails once, and checks the signature of every Event
+	var events []Event
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Translation-Signature") != Sign("s3cret", body) {
+			t.Errorf("Invalid signature: %s", r.Header.Get("X-Translation-Signature"))
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error(err)
+		}
+		events = append(events, e)
+	}))
+	defer ts.Close()
+
+	c := &Collection{}
+	v := &url.Values{}
+	v.Set("name", "Webhooks")
+	c.Post(v)
+
+	t.Log("POST Webhook with an invalid url")
+	cw := Router("/collections/" + c.Id.Hex() + "/webhooks")
+	v = &url.Values{}
+	v.Set("url", "localhost/hook")
+	if status, _ := cw.Post(v); status != 422 {
+		t.Errorf("Expected status 422, got: %d", status)
+	}
+
+	t.Log("POST Webhook")
+	v = &url.Values{}
+	v.Set("url", ts.URL)
+	v.Set("event", EventTranslated)
+	v.Set("secret", "s3cret")
+	status, res := cw.Post(v)
+	if status != 200 {
+		t.Fatalf("Could not POST Webhook, status: %d", status)
+	}
+	var pw struct {
+		Webhook Webhook
+		Secret  string
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &pw)
+	if pw.Secret != "s3cret" || len(pw.Webhook.Events) != 1 {
+		t.Errorf("Unexpected Webhook: %v", pw)
+	}
+
+	t.Log("Translate a String")
+	cs := &CollectionStrings{}
+	cs.Collection.Id = c.Id
+	v = &url.Values{}
+	v.Set("string", "Notify me")
+	cs.Post(v)
+	runJobs(t)
+
+	pending, _ := store.FindDeliveries([]string{DeliveryPending})
+	if len(pending) != 1 || pending[0].Event != EventTranslated {
+		t.Fatalf("Unexpected Deliveries: %v", pending)
+	}
+
+	t.Log("Deliver with a retry")
+	for i := 0; i < 2; i++ {
+		if err := hooks.Deliver(pending[0].Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events) != 1 || events[0].String.String != "Notify me" || len(events[0].Languages) != 3 {
+		t.Errorf("Unexpected Events: %v", events)
+	}
+
+	t.Log("GET Deliveries of Webhook")
+	status, res = Router("/collections/" + c.Id.Hex() + "/webhooks/" + pw.Webhook.Id.Hex() + "/deliveries").Get(&url.Values{})
+	var pd struct {
+		Deliveries []Delivery
+	}
+	json.Unmarshal([]byte(res.ToJSON()), &pd)
+	if status != 200 || len(pd.Deliveries) != 1 {
+		t.Fatalf("Unexpected Deliveries, status: %d, %v", status, pd)
+	}
+	if d := pd.Deliveries[0]; d.State != DeliveryDelivered || d.Attempts != 2 || d.StatusCode != 200 {
+		t.Errorf("Delivery should be delivered: %v", d)
+	}
+}
+
+func TestWebhooksSlowEndpoint(t *testing.T) {
+
+	store = NewMemoryStore()
+	hooks = NewDispatcher()
+	defer func() { hooks = nil }()
+	if err := hooks.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow receiver only responds once the fast one got its Event
+	release := make(chan bool)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	received := make(chan bool, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- true
+	}))
+	defer fast.Close()
+
+	c := &Collection{Id: bson.NewObjectId()}
+	for _, u := range []string{slow.URL, fast.URL} {
+		w := &Webhook{Id: bson.NewObjectId(), CollectionId: c.Id, URL: u, Events: webhookEvents}
+		if err := store.InsertWebhook(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Log("A slow Webhook does not hold up the others")
+	if err := hooks.Publish(Event{Type: EventTranslated, CollectionId: c.Id}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Error("The fast Webhook was blocked by the slow one")
+	}
+	close(release)
+}